@@ -3,9 +3,11 @@ module github.com/spruce-solutions/quai-manager
 go 1.16
 
 require (
-	github.com/TwiN/go-color v1.1.0 // indirect
+	github.com/TwiN/go-color v1.1.0
 	github.com/fatih/color v1.9.0
+	github.com/gorilla/websocket v1.4.2
 	github.com/hashicorp/golang-lru v0.5.5-0.20210104140557-80c98217689d
 	github.com/spf13/viper v1.9.0
 	github.com/spruce-solutions/go-quai v0.1.0-pre.2.0.20220707223122-db1412bbf6dc
+	gopkg.in/yaml.v2 v2.4.0
 )
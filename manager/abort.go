@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/spruce-solutions/go-quai/common"
+)
+
+// submissionCancel is a mined block submission in flight as served by /abort.
+type submissionCancel struct {
+	Context string      `json:"context"`
+	Hash    common.Hash `json:"hash"`
+
+	cancel context.CancelFunc
+}
+
+// submissionCancels keeps the cancel functions of the mined block submissions in flight, so
+// that an operator can stop submitting into a bad fork.
+type submissionCancels struct {
+	lock     sync.Mutex
+	next     uint64
+	inflight map[uint64]*submissionCancel
+}
+
+func newSubmissionCancels() *submissionCancels {
+	return &submissionCancels{inflight: make(map[uint64]*submissionCancel)}
+}
+
+// Start returns the context of the submission of the mined block and the function to call once
+// the submission finished.
+func (s *submissionCancels) Start(difficultyContext int, hash common.Hash) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.lock.Lock()
+	id := s.next
+	s.next++
+	s.inflight[id] = &submissionCancel{Context: contextNames[difficultyContext], Hash: hash, cancel: cancel}
+	s.lock.Unlock()
+	return ctx, func() {
+		s.lock.Lock()
+		delete(s.inflight, id)
+		s.lock.Unlock()
+		cancel()
+	}
+}
+
+// CancelAll cancels every submission in flight and returns them. The RPCs already sent to a
+// node are abandoned, whether the node processed them is not known.
+func (s *submissionCancels) CancelAll() []*submissionCancel {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	canceled := []*submissionCancel{}
+	for _, submission := range s.inflight {
+		submission.cancel()
+		canceled = append(canceled, submission)
+	}
+	return canceled
+}
+
+// Len returns the number of submissions in flight.
+func (s *submissionCancels) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.inflight)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/spruce-solutions/go-quai/common"
+	"github.com/spruce-solutions/go-quai/core/types"
+	"github.com/spruce-solutions/go-quai/ethclient"
+)
+
+const (
+	// maxTrackedSubmissions bounds the submissions awaiting confirmation per context.
+	maxTrackedSubmissions = 256
+	// acceptanceQueueSize bounds the due submissions waiting for their confirmation lookup.
+	acceptanceQueueSize = 64
+	// alertWebhookTimeout bounds the delivery of a single webhook alert.
+	alertWebhookTimeout = 5 * time.Second
+)
+
+var (
+	// acceptedBlocksCounters count submitted blocks found canonical after the acceptance depth.
+	acceptedBlocksCounters = newContextCounters("manager/blocks/accepted")
+	// orphanedBlocksCounters count submitted blocks replaced on the canonical chain.
+	orphanedBlocksCounters = newContextCounters("manager/blocks/orphaned")
+)
+
+// submittedBlock is a mined block awaiting confirmation on the chain it was submitted to.
+type submittedBlock struct {
+	chain  [2]byte // location of the chain, see chainLocation
+	hash   common.Hash
+	number *big.Int
+}
+
+// acceptanceCheck is a submitted block due for confirmation and the client of its chain.
+type acceptanceCheck struct {
+	client            *ethclient.Client
+	difficultyContext int
+	submitted         *submittedBlock
+}
+
+// blockAlert is the JSON document posted to the alert webhook for an orphaned block.
+type blockAlert struct {
+	Context       string      `json:"context"`
+	Number        string      `json:"number"`
+	Hash          common.Hash `json:"hash"`
+	CanonicalHash common.Hash `json:"canonicalHash"`
+}
+
+// acceptanceTracker correlates submitted blocks with the heads of their chains and reports the
+// ones that are not canonical once their chain has advanced depth blocks past them. The lookups
+// and alerts of the due blocks run in loop, so that they never hold up the head relay.
+type acceptanceTracker struct {
+	depth   int64
+	webhook string
+	checks  chan *acceptanceCheck
+
+	lock    sync.Mutex
+	pending [3][]*submittedBlock
+}
+
+// newAcceptanceTracker creates a tracker confirming blocks depth heads after their submission.
+// Orphaned blocks are posted to webhook unless it is empty.
+func newAcceptanceTracker(depth int, webhook string) *acceptanceTracker {
+	return &acceptanceTracker{depth: int64(depth), webhook: webhook, checks: make(chan *acceptanceCheck, acceptanceQueueSize)}
+}
+
+// Track records a block of the given context that was submitted to the chain at the location.
+func (t *acceptanceTracker) Track(difficultyContext int, chain [2]byte, header *types.Header) {
+	if t.depth <= 0 || header.Number[difficultyContext] == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	pending := append(t.pending[difficultyContext], &submittedBlock{chain: chain, hash: header.Hash(), number: header.Number[difficultyContext]})
+	if len(pending) > maxTrackedSubmissions {
+		pending = pending[len(pending)-maxTrackedSubmissions:]
+	}
+	t.pending[difficultyContext] = pending
+}
+
+// CheckHead queues the submissions to the chain of the new head that it buried at least depth
+// blocks deep for loop to confirm through client. Submissions are dropped if the queue is full.
+func (t *acceptanceTracker) CheckHead(client *ethclient.Client, difficultyContext int, head *types.Header) {
+	if t.depth <= 0 || head.Number[difficultyContext] == nil {
+		return
+	}
+	chain := chainLocation(head.Location, difficultyContext)
+	t.lock.Lock()
+	var due, remaining []*submittedBlock
+	for _, submitted := range t.pending[difficultyContext] {
+		if submitted.chain == chain && new(big.Int).Sub(head.Number[difficultyContext], submitted.number).Int64() >= t.depth {
+			due = append(due, submitted)
+		} else {
+			remaining = append(remaining, submitted)
+		}
+	}
+	t.pending[difficultyContext] = remaining
+	t.lock.Unlock()
+
+	for _, submitted := range due {
+		select {
+		case t.checks <- &acceptanceCheck{client: client, difficultyContext: difficultyContext, submitted: submitted}:
+		default:
+			log.Println("Acceptance queue full, not confirming mined block", "context", contextNames[difficultyContext], "number", submitted.number, "hash", submitted.hash)
+		}
+	}
+}
+
+// loop confirms the queued submissions.
+func (t *acceptanceTracker) loop() {
+	for check := range t.checks {
+		t.confirm(check.client, check.difficultyContext, check.submitted)
+	}
+}
+
+// confirm reports whether the submitted block is canonical on the chain of client.
+func (t *acceptanceTracker) confirm(client *ethclient.Client, difficultyContext int, submitted *submittedBlock) {
+	canonical, err := client.HeaderByNumber(context.Background(), submitted.number)
+	if err != nil {
+		log.Println("Failed to confirm mined block", "context", contextNames[difficultyContext], "number", submitted.number, "hash", submitted.hash, "err", err)
+		return
+	}
+	if canonical.Hash() == submitted.hash {
+		acceptedBlocksCounters[difficultyContext].Inc(1)
+		log.Println("Mined block accepted", "context", contextNames[difficultyContext], "number", submitted.number, "hash", submitted.hash)
+		return
+	}
+	orphanedBlocksCounters[difficultyContext].Inc(1)
+	log.Println("Mined block not accepted", "context", contextNames[difficultyContext], "number", submitted.number, "hash", submitted.hash, "canonical", canonical.Hash())
+	if t.webhook != "" {
+		t.alert(&blockAlert{Context: contextNames[difficultyContext], Number: submitted.number.String(), Hash: submitted.hash, CanonicalHash: canonical.Hash()})
+	}
+}
+
+// alert posts the alert to the webhook.
+func (t *acceptanceTracker) alert(alert *blockAlert) {
+	postAlert(t.webhook, alert)
+}
+
+// postAlert posts the alert as JSON to the webhook.
+func postAlert(webhook string, alert interface{}) {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		log.Println("Failed to encode block alert", "err", err)
+		return
+	}
+	client := &http.Client{Timeout: alertWebhookTimeout}
+	resp, err := client.Post(webhook, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		log.Println("Failed to deliver block alert", "err", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Println("Block alert rejected by webhook", "status", resp.Status)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spruce-solutions/go-quai/core/types"
+)
+
+// newTestChainHead returns a head of the chain at the location in the context at the number.
+func newTestChainHead(location []byte, number int64) *types.Header {
+	head := newTestHead(number)
+	head.Location = location
+	return head
+}
+
+func TestAcceptanceChecksOffTheHeadRelay(t *testing.T) {
+	alerts := make(chan blockAlert, 4)
+	release := make(chan struct{})
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert blockAlert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Error(err)
+		}
+		<-release
+		alerts <- alert
+	}))
+	defer webhook.Close()
+	defer close(release)
+
+	tracker := newAcceptanceTracker(2, webhook.URL)
+	go tracker.loop()
+	// the node of zone [1 1] has another block as canonical at every number
+	zone, _ := newTestClient(t, newTestChainHead([]byte{1, 1}, 1), false)
+
+	first := newTestChainHead([]byte{1, 1}, 10)
+	tracker.Track(2, [2]byte{1, 1}, first)
+	tracker.CheckHead(zone.client, 2, newTestChainHead([]byte{2, 2}, 20))
+	tracker.CheckHead(zone.client, 2, newTestChainHead([]byte{1, 1}, 11))
+	select {
+	case alert := <-alerts:
+		t.Fatalf("alert %v before the zone of the block advanced the depth", alert)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the alert of the first block holds up the loop, the head relay goes on
+	tracker.CheckHead(zone.client, 2, newTestChainHead([]byte{1, 1}, 12))
+	second := newTestChainHead([]byte{1, 1}, 11)
+	second.Nonce = types.EncodeNonce(1)
+	tracker.Track(2, [2]byte{1, 1}, second)
+	checked := make(chan struct{})
+	go func() {
+		tracker.CheckHead(zone.client, 2, newTestChainHead([]byte{1, 1}, 13))
+		close(checked)
+	}()
+	select {
+	case <-checked:
+	case <-time.After(time.Second):
+		t.Fatal("new head waited for the confirmation of a previous one")
+	}
+
+	release <- struct{}{}
+	release <- struct{}{}
+	for _, want := range []*types.Header{first, second} {
+		select {
+		case alert := <-alerts:
+			if alert.Hash != want.Hash() || alert.Number != want.Number[2].String() {
+				t.Errorf("alert for block %v %s, want %v %s", alert.Hash, alert.Number, want.Hash(), want.Number[2])
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no alert for block %v", want.Hash())
+		}
+	}
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	if pending := len(tracker.pending[2]); pending != 0 {
+		t.Errorf("%d blocks still tracked", pending)
+	}
+}
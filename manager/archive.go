@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spruce-solutions/go-quai/core/types"
+	"github.com/spruce-solutions/go-quai/metrics"
+	"github.com/spruce-solutions/quai-manager/manager/util"
+)
+
+// archiveUploadTimeout bounds the upload of a single archived block.
+const archiveUploadTimeout = 30 * time.Second
+
+// droppedArchiveCounter counts the mined blocks not archived because the archive queue was full.
+var droppedArchiveCounter = metrics.NewRegisteredCounterForced("manager/archive/dropped", nil)
+
+// archivedBlock is a mined block with the body and receipts of the pending block it was sealed
+// with, as written to the archive.
+type archivedBlock struct {
+	Context      int                `json:"context"`
+	Location     []byte             `json:"location"`
+	Header       *types.Header      `json:"header"`
+	Transactions types.Transactions `json:"transactions"`
+	Uncles       []*types.Header    `json:"uncles"`
+	Receipts     []*types.Receipt   `json:"receipts"`
+}
+
+// blockArchive writes the mined blocks to ArchiveDir and uploads them to ArchiveURL in the
+// background, so that a slow sink never holds up the submissions.
+type blockArchive struct {
+	dir    string
+	url    string
+	client *http.Client
+	queue  chan *archivedBlock
+}
+
+// newBlockArchive returns an archive to the directory and URL, either of which may be empty,
+// buffering up to size blocks.
+func newBlockArchive(dir string, url string, size int) *blockArchive {
+	return &blockArchive{
+		dir:    dir,
+		url:    strings.TrimSuffix(url, "/"),
+		client: &http.Client{Timeout: archiveUploadTimeout},
+		queue:  make(chan *archivedBlock, size),
+	}
+}
+
+// Archive queues the header mined in the context with the pending block it was sealed with.
+// The block is dropped if the queue is full.
+func (a *blockArchive) Archive(mined int, header *types.Header, pending *types.ReceiptBlock, location []byte) {
+	block := &archivedBlock{Context: mined, Location: location, Header: header}
+	if pending != nil {
+		block.Transactions, block.Uncles, block.Receipts = pending.Transactions(), pending.Uncles(), pending.Receipts()
+	}
+	select {
+	case a.queue <- block:
+	default:
+		droppedArchiveCounter.Inc(1)
+		log.Println("Archive queue full, not archiving mined block", "context", contextNames[mined], "hash", header.Hash())
+	}
+}
+
+// loop writes and uploads the queued blocks.
+func (a *blockArchive) loop() {
+	for block := range a.queue {
+		hash := block.Header.Hash()
+		data, err := json.Marshal(block)
+		if err != nil {
+			log.Println("Failed to encode archived block", "hash", hash, "err", err)
+			continue
+		}
+		name := hash.Hex() + ".json"
+		if a.dir != "" {
+			if err := a.write(name, data); err != nil {
+				log.Println("Failed to archive mined block", "dir", a.dir, "hash", hash, "err", err)
+			}
+		}
+		if a.url != "" {
+			if err := a.upload(name, data); err != nil {
+				log.Println("Failed to upload archived block", "url", util.RedactURL(a.url), "hash", hash, "err", err)
+			}
+		}
+	}
+}
+
+// write writes the archived block to the directory.
+func (a *blockArchive) write(name string, data []byte) error {
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(a.dir, name), data, 0644)
+}
+
+// upload PUTs the archived block under the URL.
+func (a *blockArchive) upload(name string, data []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPut, a.url+"/"+name, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("archive rejected the block: %s", resp.Status)
+	}
+	return nil
+}
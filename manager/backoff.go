@@ -0,0 +1,41 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// backoffResetWindow is how long a retried operation must succeed without a failure for its
+// back-off to start over, 0 to never start over. It is set from BackoffResetWindow at startup.
+var backoffResetWindow = 5 * time.Minute
+
+// backoff counts the attempts of a retried operation for its exponential back-off. The count
+// starts over once the operation succeeded for backoffResetWindow, so that an outage after a
+// stable period doesn't inherit the delay of the previous one. The zero value is ready to use.
+type backoff struct {
+	lock        sync.Mutex
+	attempts    int
+	stableSince time.Time // first success since the last failure, zero after a failure
+}
+
+// Succeed records a success of the operation.
+func (b *backoff) Succeed() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.stableSince.IsZero() {
+		b.stableSince = time.Now()
+	}
+}
+
+// Fail records a failure of the operation and returns the number of its attempt, counted since
+// the back-off last started over.
+func (b *backoff) Fail() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if backoffResetWindow > 0 && !b.stableSince.IsZero() && time.Since(b.stableSince) >= backoffResetWindow {
+		b.attempts = 0
+	}
+	b.stableSince = time.Time{}
+	b.attempts++
+	return b.attempts
+}
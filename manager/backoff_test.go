@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffCountsFailures(t *testing.T) {
+	var b backoff
+	for want := 1; want <= 3; want++ {
+		if got := b.Fail(); got != want {
+			t.Errorf("failure %d counted as attempt %d", want, got)
+		}
+	}
+	// a success shorter than the window doesn't start over
+	b.Succeed()
+	if got := b.Fail(); got != 4 {
+		t.Errorf("failure after a short success counted as attempt %d, want 4", got)
+	}
+}
+
+func TestBackoffStartsOverAfterStableWindow(t *testing.T) {
+	defer func(window time.Duration) { backoffResetWindow = window }(backoffResetWindow)
+	backoffResetWindow = time.Minute
+
+	var b backoff
+	b.Fail()
+	b.Fail()
+	b.Succeed()
+	// the first success decides when the stable period started, later ones don't move it
+	b.stableSince = b.stableSince.Add(-2 * time.Minute)
+	b.Succeed()
+	if got := b.Fail(); got != 1 {
+		t.Errorf("failure after a stable window counted as attempt %d, want 1", got)
+	}
+	// failing for longer than the window without a success keeps counting
+	b.stableSince = time.Time{}
+	if got := b.Fail(); got != 2 {
+		t.Errorf("repeated failure counted as attempt %d, want 2", got)
+	}
+
+	backoffResetWindow = 0
+	b.Succeed()
+	b.stableSince = b.stableSince.Add(-time.Hour)
+	if got := b.Fail(); got != 3 {
+		t.Errorf("failure with the window disabled counted as attempt %d, want 3", got)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/spruce-solutions/go-quai/core/types"
+	"github.com/spruce-solutions/go-quai/ethclient"
+	"github.com/spruce-solutions/go-quai/rpc"
+)
+
+// externalBlockEncoder produces the quai_sendExternalBlock parameters of external blocks. The
+// marshalling lives in an internal package of go-quai, so the block is sent through ethclient
+// to an in-process server that keeps the parameters it receives.
+type externalBlockEncoder struct {
+	lock    sync.Mutex
+	client  *ethclient.Client
+	payload json.RawMessage
+}
+
+// externalBlockCapture is the quai service of the in-process server.
+type externalBlockCapture struct {
+	encoder *externalBlockEncoder
+}
+
+// SendExternalBlock keeps the parameters of the call, served as quai_sendExternalBlock.
+func (c *externalBlockCapture) SendExternalBlock(payload json.RawMessage) error {
+	c.encoder.payload = payload
+	return nil
+}
+
+func newExternalBlockEncoder() (*externalBlockEncoder, error) {
+	encoder := &externalBlockEncoder{}
+	server := rpc.NewServer()
+	if err := server.RegisterName("quai", &externalBlockCapture{encoder: encoder}); err != nil {
+		return nil, err
+	}
+	encoder.client = ethclient.NewClient(rpc.DialInProc(server))
+	return encoder, nil
+}
+
+// Encode returns the quai_sendExternalBlock parameters of the external block.
+func (e *externalBlockEncoder) Encode(block *types.Block, receipts []*types.Receipt, mined int) (json.RawMessage, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.payload = nil
+	if err := e.client.SendExternalBlock(context.Background(), block, receipts, big.NewInt(int64(mined))); err != nil {
+		return nil, err
+	}
+	return e.payload, nil
+}
+
+// batchedExternalBlock is an external block waiting in a batch, done is closed once err is set.
+type batchedExternalBlock struct {
+	payload json.RawMessage
+	send    func() error // sends the block on its own if the batch fails
+	done    chan struct{}
+	err     error
+}
+
+// externalBatch are the external blocks collected for one chain during a window.
+type externalBatch struct {
+	client *rpc.Client
+	blocks []*batchedExternalBlock
+}
+
+// externalBatcher accumulates the external blocks sent to each chain for a short window and
+// sends them in a single JSON-RPC batch, which saves round trips while catching up. Chains that
+// fail batches but accept the same blocks one by one are sent individually from then on.
+type externalBatcher struct {
+	window  time.Duration
+	size    int
+	encoder *externalBlockEncoder
+
+	lock        sync.Mutex
+	pending     map[[2]byte]*externalBatch
+	unsupported map[[2]byte]bool
+}
+
+// newExternalBatcher creates a batcher that sends a batch once it holds size blocks or the
+// window since its first block has passed.
+func newExternalBatcher(window time.Duration, size int) (*externalBatcher, error) {
+	encoder, err := newExternalBlockEncoder()
+	if err != nil {
+		return nil, err
+	}
+	if size <= 0 {
+		size = 1
+	}
+	return &externalBatcher{
+		window:      window,
+		size:        size,
+		encoder:     encoder,
+		pending:     make(map[[2]byte]*externalBatch),
+		unsupported: make(map[[2]byte]bool),
+	}, nil
+}
+
+// Send adds the external block to the batch of the chain at the target location and waits for
+// the batch to be sent or ctx to be canceled. send is used instead if the chain doesn't support
+// batches.
+func (b *externalBatcher) Send(ctx context.Context, target []byte, client *rpc.Client, block *types.Block, receipts []*types.Receipt, mined int, send func() error) error {
+	key := [2]byte{target[0], target[1]}
+	b.lock.Lock()
+	unsupported := b.unsupported[key]
+	b.lock.Unlock()
+	if unsupported || client == nil {
+		return send()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	payload, err := b.encoder.Encode(block, receipts, mined)
+	if err != nil {
+		return send()
+	}
+	queued := &batchedExternalBlock{payload: payload, send: send, done: make(chan struct{})}
+
+	b.lock.Lock()
+	batch, ok := b.pending[key]
+	if !ok {
+		batch = &externalBatch{client: client}
+		b.pending[key] = batch
+		time.AfterFunc(b.window, func() { b.flush(key, batch) })
+	}
+	batch.blocks = append(batch.blocks, queued)
+	full := len(batch.blocks) >= b.size
+	b.lock.Unlock()
+
+	if full {
+		b.flush(key, batch)
+	}
+	select {
+	case <-queued.done:
+		return queued.err
+	case <-ctx.Done():
+		// the batch can't be withdrawn from, it may still be sent
+		return ctx.Err()
+	}
+}
+
+// flush sends the batch unless it was sent already.
+func (b *externalBatcher) flush(key [2]byte, batch *externalBatch) {
+	b.lock.Lock()
+	if b.pending[key] != batch {
+		b.lock.Unlock()
+		return
+	}
+	delete(b.pending, key)
+	b.lock.Unlock()
+
+	elems := make([]rpc.BatchElem, len(batch.blocks))
+	for i, queued := range batch.blocks {
+		elems[i] = rpc.BatchElem{Method: "quai_sendExternalBlock", Args: []interface{}{queued.payload}}
+	}
+	err := batch.client.BatchCallContext(context.Background(), elems)
+	if err == nil {
+		for i, queued := range batch.blocks {
+			queued.err = elems[i].Error
+			close(queued.done)
+		}
+		return
+	}
+
+	log.Println("Failed to send external block batch, sending individually", "target", key, "blocks", len(elems), "err", err)
+	sent := true
+	for _, queued := range batch.blocks {
+		queued.err = queued.send()
+		sent = sent && queued.err == nil
+		close(queued.done)
+	}
+	if sent {
+		b.lock.Lock()
+		b.unsupported[key] = true
+		b.lock.Unlock()
+		log.Println("Node does not support batches, sending external blocks individually", "target", key)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/spruce-solutions/go-quai/common"
+	"github.com/spruce-solutions/go-quai/consensus/blake3"
+	"github.com/spruce-solutions/go-quai/core/types"
+)
+
+// benchHeader returns a synthetic header the size of a real combined header, whose difficulty
+// is high enough that no nonce is found while benchmarking.
+func benchHeader() *types.Header {
+	difficulty := new(big.Int).Lsh(big.NewInt(1), 255)
+	header := &types.Header{
+		ParentHash:        make([]common.Hash, 3),
+		Number:            make([]*big.Int, 3),
+		Extra:             make([][]byte, 3),
+		Time:              uint64(time.Now().Unix()),
+		BaseFee:           make([]*big.Int, 3),
+		GasLimit:          make([]uint64, 3),
+		Coinbase:          make([]common.Address, 3),
+		Difficulty:        make([]*big.Int, 3),
+		NetworkDifficulty: make([]*big.Int, 3),
+		Root:              make([]common.Hash, 3),
+		TxHash:            make([]common.Hash, 3),
+		UncleHash:         make([]common.Hash, 3),
+		ReceiptHash:       make([]common.Hash, 3),
+		GasUsed:           make([]uint64, 3),
+		Bloom:             make([]types.Bloom, 3),
+		Location:          []byte{1, 1},
+	}
+	for i := range header.Number {
+		header.Number[i] = big.NewInt(1)
+		header.BaseFee[i] = big.NewInt(1)
+		header.Difficulty[i] = difficulty
+		header.NetworkDifficulty[i] = difficulty
+	}
+	return header
+}
+
+// runBench is the bench command. It hashes a synthetic header with the blake3 engine on the
+// given number of threads for the given duration and prints the achieved hashrate, without
+// connecting to any node.
+func runBench(args []string) {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	duration := flags.Duration("duration", 10*time.Second, "how long to hash")
+	threads := flags.Int("threads", runtime.NumCPU(), "number of hashing threads")
+	flags.Parse(args)
+	if *threads <= 0 || *duration <= 0 {
+		log.Fatal("bench needs a positive duration and thread count")
+	}
+
+	engine, err := blake3.New(blake3.Config{MiningThreads: *threads}, nil, false)
+	if err != nil {
+		log.Fatal("Failed to create Blake3 engine: ", err)
+	}
+	defer engine.Close()
+
+	fmt.Printf("Hashing for %v on %d threads...\n", *duration, *threads)
+	hashes := make([]uint64, *threads)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range hashes {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			// the same search as the engine's miner threads, each on its own nonce range
+			header := benchHeader()
+			target := new(big.Int).Div(big2e256, header.Difficulty[2])
+			pow := new(big.Int)
+			nonce := uint64(id) << 48
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				// check for the stop only every 4096 hashes
+				for n := 0; n < 4096; n++ {
+					header.Nonce = types.EncodeNonce(nonce)
+					pow.SetBytes(engine.SealHash(header).Bytes())
+					if pow.Cmp(target) <= 0 {
+						log.Println("Found a nonce for the synthetic header", "nonce", nonce)
+					}
+					nonce++
+				}
+				hashes[id] += 4096
+			}
+		}(i)
+	}
+	start := time.Now()
+	time.Sleep(*duration)
+	close(stop)
+	wg.Wait()
+	elapsed := time.Since(start).Seconds()
+
+	var total uint64
+	for i, count := range hashes {
+		total += count
+		fmt.Printf("thread %d: %s\n", i, formatHashrate(float64(count)/elapsed))
+	}
+	fmt.Printf("total: %s\n", formatHashrate(float64(total)/elapsed))
+}
+
+// formatHashrate formats hashes per second with a metric prefix.
+func formatHashrate(rate float64) string {
+	units := []string{"H/s", "kH/s", "MH/s", "GH/s"}
+	unit := 0
+	for rate >= 1000 && unit < len(units)-1 {
+		rate /= 1000
+		unit++
+	}
+	return fmt.Sprintf("%.2f %s", rate, units[unit])
+}
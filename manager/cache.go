@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/spruce-solutions/go-quai/common"
+	"github.com/spruce-solutions/go-quai/core/types"
+	"github.com/spruce-solutions/go-quai/ethclient"
+	"github.com/spruce-solutions/go-quai/metrics"
+)
+
+const (
+	// cacheStatsInterval is how often the cache statistics are logged.
+	cacheStatsInterval = time.Minute
+	// memoryBudgetTarget is the fraction of the memory budget caches evict down to once they
+	// exceed it, so that they don't evict again on every insertion.
+	memoryBudgetTarget = 0.9
+)
+
+// memoryBudget bounds the approximate number of bytes held by the caches sharing it.
+type memoryBudget struct {
+	limit int64 // bytes, 0 for no limit
+	used  int64 // accessed atomically
+}
+
+// newMemoryBudget creates a budget of the given number of megabytes, 0 for no limit.
+func newMemoryBudget(megabytes int) *memoryBudget {
+	if megabytes < 0 {
+		megabytes = 0
+	}
+	return &memoryBudget{limit: int64(megabytes) << 20}
+}
+
+// add accounts for size more bytes, negative when released.
+func (b *memoryBudget) add(size int64) {
+	atomic.AddInt64(&b.used, size)
+}
+
+// Used returns the number of bytes accounted for.
+func (b *memoryBudget) Used() int64 {
+	return atomic.LoadInt64(&b.used)
+}
+
+// exceeded reports whether more than the limit is used.
+func (b *memoryBudget) exceeded() bool {
+	return b.limit > 0 && b.Used() > b.limit
+}
+
+// aboveTarget reports whether more than the eviction target is used.
+func (b *memoryBudget) aboveTarget() bool {
+	return b.limit > 0 && float64(b.Used()) > float64(b.limit)*memoryBudgetTarget
+}
+
+// receiptBlockSize approximates the memory held by the receipt block.
+func receiptBlockSize(receiptBlock *types.ReceiptBlock) int64 {
+	size := receiptBlock.Header().Size()
+	for _, uncle := range receiptBlock.Uncles() {
+		size += uncle.Size()
+	}
+	for _, tx := range receiptBlock.Transactions() {
+		size += tx.Size()
+	}
+	for _, receipt := range receiptBlock.Receipts() {
+		size += receipt.Size()
+	}
+	return int64(size)
+}
+
+// receiptCacheEntry is a cached receipt block together with the time it was fetched.
+type receiptCacheEntry struct {
+	receiptBlock *types.ReceiptBlock
+	fetchedAt    time.Time
+	size         int64
+}
+
+// receiptCache is a read-through cache for block receipts keyed by block hash.
+type receiptCache struct {
+	cache  *lru.Cache
+	ttl    time.Duration
+	budget *memoryBudget
+
+	hits      metrics.Counter
+	misses    metrics.Counter
+	evictions metrics.Counter
+}
+
+// newReceiptCache creates a receipt cache holding up to size entries for at most ttl, evicting
+// the oldest entries while the budget is exceeded. A non-positive size disables caching.
+func newReceiptCache(size int, ttl time.Duration, budget *memoryBudget) (*receiptCache, error) {
+	c := &receiptCache{
+		ttl:       ttl,
+		budget:    budget,
+		hits:      metrics.NewRegisteredCounterForced("manager/cache/receipts/hit", nil),
+		misses:    metrics.NewRegisteredCounterForced("manager/cache/receipts/miss", nil),
+		evictions: metrics.NewRegisteredCounterForced("manager/cache/receipts/evict", nil),
+	}
+	if size <= 0 {
+		return c, nil
+	}
+	cache, err := lru.NewWithEvict(size, func(key interface{}, value interface{}) {
+		budget.add(-value.(*receiptCacheEntry).size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.cache = cache
+	return c, nil
+}
+
+// GetBlockReceipts returns the receipts for the given block hash, consulting the cache before
+// requesting them from the client.
+func (c *receiptCache) GetBlockReceipts(client *ethclient.Client, hash common.Hash) (*types.ReceiptBlock, error) {
+	if c.cache != nil {
+		if cached, ok := c.cache.Get(hash); ok {
+			entry := cached.(*receiptCacheEntry)
+			if time.Since(entry.fetchedAt) < c.ttl {
+				c.hits.Inc(1)
+				return entry.receiptBlock, nil
+			}
+			c.cache.Remove(hash)
+		}
+		c.misses.Inc(1)
+	}
+
+	receiptBlock, err := client.GetBlockReceipts(context.Background(), hash)
+	if err != nil || receiptBlock == nil {
+		return receiptBlock, err
+	}
+	if c.cache != nil {
+		c.add(hash, receiptBlock)
+	}
+	return receiptBlock, nil
+}
+
+// Forget drops the cached receipts for the given block hash, if any.
+func (c *receiptCache) Forget(hash common.Hash) {
+	if c.cache != nil {
+		c.cache.Remove(hash)
+	}
+}
+
+// add caches the receipt block and evicts the oldest entries if that exceeds the budget.
+func (c *receiptCache) add(hash common.Hash, receiptBlock *types.ReceiptBlock) {
+	entry := &receiptCacheEntry{receiptBlock: receiptBlock, fetchedAt: time.Now(), size: receiptBlockSize(receiptBlock)}
+	if c.budget.limit > 0 && entry.size > c.budget.limit {
+		// would evict everything and still not fit
+		return
+	}
+	// account before adding, the entry may be evicted right away
+	c.budget.add(entry.size)
+	present, evicted := c.cache.ContainsOrAdd(hash, entry)
+	if present {
+		// fetched concurrently, the cached entry is kept
+		c.budget.add(-entry.size)
+		return
+	}
+	if evicted {
+		c.evictions.Inc(1)
+	}
+	if !c.budget.exceeded() {
+		return
+	}
+	for c.budget.aboveTarget() {
+		if _, _, ok := c.cache.RemoveOldest(); !ok {
+			break
+		}
+		c.evictions.Inc(1)
+	}
+}
+
+// logCacheStats periodically logs the hits, misses and evictions of the receipt cache and the
+// memory it holds.
+func (m *Manager) logCacheStats() {
+	ticker := time.NewTicker(cacheStatsInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		c := m.receiptCache
+		log.Println("Receipt cache", "entries", c.cache.Len(), "bytes", c.budget.Used(), "budget", c.budget.limit, "hits", c.hits.Count(), "misses", c.misses.Count(), "evictions", c.evictions.Count())
+	}
+}
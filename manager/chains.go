@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spruce-solutions/go-quai/ethclient"
+	"github.com/spruce-solutions/quai-manager/manager/util"
+)
+
+// errInvalidChainOverride is returned for ChainOverrides that name no chain of the clients.
+var errInvalidChainOverride = errors.New("invalid chain override")
+
+// checkChainOverrides returns an error unless the ChainOverrides name chains of the clients.
+func checkChainOverrides(overrides util.ChainOverrides, clients orderedBlockClients) error {
+	if overrides.Region < 0 || overrides.Region > len(clients.regions) {
+		return fmt.Errorf("%w: region %d", errInvalidChainOverride, overrides.Region)
+	}
+	zone := overrides.Zone
+	if len(zone) == 0 {
+		return nil
+	}
+	if len(zone) != 2 || zone[0] < 1 || zone[0] > len(clients.zones) || zone[1] < 1 || zone[1] > len(clients.zones[zone[0]-1]) {
+		return fmt.Errorf("%w: zone %v", errInvalidChainOverride, zone)
+	}
+	return nil
+}
+
+// miningSlice is the prime, region and zone chain mined at a location, indexed by context. It
+// is the one place the clients of a location are looked up, every other mining path goes
+// through it.
+type miningSlice struct {
+	locations [3][]byte       // locations of the chains, [0, 0], [region, 0] and [region, zone]
+	chains    [3]*blockClient // clients of the chains
+}
+
+// sliceAt returns the slice mined at the location: prime and the region and zone of the
+// location, or the chains ChainOverrides select instead. The location must name a zone.
+func (m *Manager) sliceAt(location []byte) miningSlice {
+	var s miningSlice
+	for i := range s.chains {
+		s.locations[i] = m.miningChain(location, i)
+		s.chains[i] = m.orderedBlockClients.at(s.locations[i])
+	}
+	return s
+}
+
+// activeSlice returns the slice mined at the current location. The caller must hold m.lock or
+// be the only one to change the location, like the optimizer and failover loops.
+func (m *Manager) activeSlice() miningSlice {
+	return m.sliceAt(m.location)
+}
+
+// miningChain returns the location of the chain mined for the context at the location.
+func (m *Manager) miningChain(location []byte, difficultyContext int) []byte {
+	overrides := m.cfg().ChainOverrides
+	switch difficultyContext {
+	case 0:
+		return []byte{0, 0}
+	case 1:
+		if overrides.Region > 0 {
+			return []byte{byte(overrides.Region), 0}
+		}
+		return []byte{location[0], 0}
+	default:
+		if len(overrides.Zone) == 2 {
+			return []byte{byte(overrides.Zone[0]), byte(overrides.Zone[1])}
+		}
+		return []byte{location[0], location[1]}
+	}
+}
+
+// chainState is a copy of the connection of a chain. Once the manager runs, the reconnects and
+// failovers change the connection under m.lock, the goroutines that don't hold it read a copy
+// taken under it instead.
+type chainState struct {
+	url       string
+	client    *ethclient.Client
+	available bool
+	pool      []*ethclient.Client
+	scan      *ethclient.Client
+	next      *uint32 // round-robin position in the pool of the blockClient
+}
+
+// state returns the connection of the chain, the zero state if it is not configured. The caller
+// must hold m.lock once the manager runs.
+func (c *blockClient) state() chainState {
+	if c == nil {
+		return chainState{}
+	}
+	return chainState{url: c.url, client: c.client, available: c.available, pool: c.pool, scan: c.scan, next: &c.next}
+}
+
+// redactedURL returns the URL of the node with any credentials redacted, for logs.
+func (s chainState) redactedURL() string {
+	return util.RedactURL(s.url)
+}
+
+// clientStates are the connections of every chain, laid out like orderedBlockClients.
+type clientStates struct {
+	prime   chainState
+	regions []chainState
+	zones   [][]chainState
+}
+
+// states returns the connections of the chains. The caller must hold m.lock once the manager runs.
+func (c orderedBlockClients) states() clientStates {
+	states := clientStates{prime: c.prime.state(), regions: make([]chainState, len(c.regions)), zones: make([][]chainState, len(c.zones))}
+	for i, region := range c.regions {
+		states.regions[i] = region.state()
+	}
+	for i, zones := range c.zones {
+		states.zones[i] = make([]chainState, len(zones))
+		for j, zone := range zones {
+			states.zones[i][j] = zone.state()
+		}
+	}
+	return states
+}
+
+// chainState returns the connection of the chain, taken under the lock.
+func (m *Manager) chainState(c *blockClient) chainState {
+	var state chainState
+	m.withLock(func() { state = c.state() })
+	return state
+}
+
+// chainStates returns the connections of every chain, taken under the lock.
+func (m *Manager) chainStates() clientStates {
+	var states clientStates
+	m.withLock(func() { states = m.orderedBlockClients.states() })
+	return states
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spruce-solutions/go-quai/common"
+	"github.com/spruce-solutions/go-quai/common/hexutil"
+	"github.com/spruce-solutions/go-quai/core/types"
+	"github.com/spruce-solutions/quai-manager/manager/util"
+)
+
+// dominantBlock returns the chain and context of the first prime or region node that has the
+// block, and its header. The header is nil if none of them has it.
+func dominantBlock(clients orderedBlockClients, hash common.Hash) ([2]byte, int, *types.Header) {
+	if clients.prime.client != nil {
+		if header, err := clients.prime.client.HeaderByHash(context.Background(), hash); err == nil && header != nil {
+			return [2]byte{0, 0}, 0, header
+		}
+	}
+	for i, region := range clients.regions {
+		if region.client == nil {
+			continue
+		}
+		if header, err := region.client.HeaderByHash(context.Background(), hash); err == nil && header != nil {
+			return [2]byte{byte(i + 1), 0}, 1, header
+		}
+	}
+	return [2]byte{}, 0, nil
+}
+
+// subordinateChains returns the chains below the prime or region chain: every region and zone
+// for prime, the zones of the region otherwise.
+func subordinateChains(clients orderedBlockClients, chain [2]byte) [][2]byte {
+	var chains [][2]byte
+	for i := range clients.regions {
+		if chain[0] != 0 && int(chain[0]) != i+1 {
+			continue
+		}
+		if chain[0] == 0 {
+			chains = append(chains, [2]byte{byte(i + 1), 0})
+		}
+		for j := range clients.zones[i] {
+			chains = append(chains, [2]byte{byte(i + 1), byte(j + 1)})
+		}
+	}
+	return chains
+}
+
+// runCheckExternal is the check-external command. It looks up the prime or region block with the
+// hash and reports which of the chains below it hold it as an external block, exiting non-zero
+// if any of them doesn't or can't be asked.
+func runCheckExternal(config util.Config, args []string) {
+	if len(args) != 1 {
+		log.Fatal("check-external needs the hash of a prime or region block")
+	}
+	if decoded, err := hexutil.Decode(args[0]); err != nil || len(decoded) != common.HashLength {
+		log.Fatal("Invalid block hash ", args[0])
+	}
+	hash := common.HexToHash(args[0])
+
+	clients := getNodeClients(config)
+	chain, difficultyContext, header := dominantBlock(clients, hash)
+	if header == nil {
+		log.Fatal("No connected prime or region node has block ", hash.Hex())
+	}
+	fmt.Printf("%s block %v number %v, location %v\n", chainName(chain), hash, header.Number[difficultyContext], header.Location)
+
+	missing := 0
+	for _, subordinate := range subordinateChains(clients, chain) {
+		client := clients.at(subordinate[:]).client
+		if client == nil {
+			fmt.Printf("%s: unknown, not connected\n", chainName(subordinate))
+			missing++
+			continue
+		}
+		externalBlock, err := client.GetExternalBlockByHashAndContext(context.Background(), hash, difficultyContext)
+		switch {
+		case externalBlock != nil:
+			fmt.Printf("%s: present\n", chainName(subordinate))
+		case err != nil:
+			fmt.Printf("%s: missing: %v\n", chainName(subordinate), err)
+			missing++
+		default:
+			fmt.Printf("%s: missing\n", chainName(subordinate))
+			missing++
+		}
+	}
+	if missing > 0 {
+		os.Exit(1)
+	}
+}
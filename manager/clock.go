@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// clockSkewTimeout bounds the requests of the latest headers the local clock is compared to.
+const clockSkewTimeout = 5 * time.Second
+
+// newestBlockTime returns the latest timestamp of the heads of the connected chains.
+func newestBlockTime(clients clientStates) (time.Time, error) {
+	chains := []chainState{clients.prime}
+	chains = append(chains, clients.regions...)
+	for _, zones := range clients.zones {
+		chains = append(chains, zones...)
+	}
+	var newest time.Time
+	for _, c := range chains {
+		if !c.available {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), clockSkewTimeout)
+		header, err := c.client.HeaderByNumber(ctx, nil)
+		cancel()
+		if err != nil || header == nil {
+			continue
+		}
+		if blockTime := time.Unix(int64(header.Time), 0); blockTime.After(newest) {
+			newest = blockTime
+		}
+	}
+	if newest.IsZero() {
+		return newest, fmt.Errorf("no chain returned its head")
+	}
+	return newest, nil
+}
+
+// checkClockSkew compares the local clock to the newest head of the connected chains. Heads
+// from the future mean the local clock is behind. Heads older than the tolerance on every chain
+// mean it is ahead, unless all chains stalled, which the error can't tell apart.
+func checkClockSkew(clients clientStates, tolerance time.Duration) error {
+	newest, err := newestBlockTime(clients)
+	if err != nil {
+		return nil
+	}
+	skew := time.Since(newest)
+	if skew < -tolerance {
+		return fmt.Errorf("local clock is %v behind the newest block", (-skew).Round(time.Second))
+	}
+	if skew > tolerance {
+		return fmt.Errorf("local clock is %v ahead of the newest block, or all chains stalled", skew.Round(time.Second))
+	}
+	return nil
+}
+
+// verifyClock warns, or exits if RefuseClockSkew is set, when the local clock is skewed by more
+// than MaxClockSkew seconds, which would produce blocks the network rejects.
+func verifyClock(clients clientStates, maxSkew int, refuse bool) {
+	if maxSkew <= 0 {
+		return
+	}
+	err := checkClockSkew(clients, time.Duration(maxSkew)*time.Second)
+	if err == nil {
+		return
+	}
+	if refuse {
+		log.Fatal("Refusing to mine with a skewed clock: ", err)
+	}
+	log.Println("Warning: the local clock looks skewed, check its time synchronization (NTP)", "err", err)
+}
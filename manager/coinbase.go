@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/spruce-solutions/go-quai/common"
+	"github.com/spruce-solutions/go-quai/core/types"
+	"github.com/spruce-solutions/go-quai/rpc"
+	"github.com/spruce-solutions/quai-manager/manager/util"
+)
+
+var (
+	// errEtherbaseRefused is returned when a node doesn't accept the etherbase it is switched to.
+	errEtherbaseRefused = errors.New("node refused the etherbase")
+	// errNotConnected is returned for requests to a chain whose node never connected.
+	errNotConnected = errors.New("node not connected")
+)
+
+// coinbaseSelector distributes the coinbase of mined blocks across a weighted set of addresses
+// using smooth weighted round-robin, so that over any window of blocks each address receives
+// its share of the total weight as closely as possible.
+//
+// The reward is credited to the coinbase in the state root of the node's pending block, so the
+// header can't be rewritten for another address. The node's etherbase is switched instead, and
+// pending blocks are only mined once the node builds them for the selected coinbase.
+type coinbaseSelector struct {
+	lock      sync.Mutex
+	addresses []common.Address
+	weights   []int
+	current   []int
+	total     int
+	selected  int
+	switched  bool // whether the node mining the context builds its pending blocks for selected
+}
+
+// newCoinbaseSelector creates a selector for the configured addresses, or nil if none are given.
+func newCoinbaseSelector(coinbases []util.CoinbaseWeight) (*coinbaseSelector, error) {
+	if len(coinbases) == 0 {
+		return nil, nil
+	}
+	s := &coinbaseSelector{current: make([]int, len(coinbases))}
+	for _, coinbase := range coinbases {
+		if !common.IsHexAddress(coinbase.Address) {
+			return nil, fmt.Errorf("invalid coinbase address %q", coinbase.Address)
+		}
+		if coinbase.Weight <= 0 {
+			return nil, fmt.Errorf("coinbase %s must have a positive weight", coinbase.Address)
+		}
+		s.addresses = append(s.addresses, common.HexToAddress(coinbase.Address))
+		s.weights = append(s.weights, coinbase.Weight)
+		s.total += coinbase.Weight
+	}
+	s.advance()
+	return s, nil
+}
+
+// Current returns the coinbase the next sealed block is credited to.
+func (s *coinbaseSelector) Current() common.Address {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.addresses[s.selected]
+}
+
+// Advance moves on to the next coinbase after a block was mined for the current one. The node
+// builds for the previous one until it is switched again.
+func (s *coinbaseSelector) Advance() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.advance()
+	s.switched = false
+}
+
+// Matches reports whether a pending block built for the coinbase may be mined: once the node was
+// switched to the selected coinbase only pending blocks built for it may be, and any while the
+// node could not be switched.
+func (s *coinbaseSelector) Matches(coinbase common.Address) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return !s.switched || coinbase == s.addresses[s.selected]
+}
+
+// setSwitched records whether the node was switched to the coinbase, unless the selection moved
+// on meanwhile.
+func (s *coinbaseSelector) setSwitched(coinbase common.Address, switched bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if coinbase == s.addresses[s.selected] {
+		s.switched = switched
+	}
+}
+
+func (s *coinbaseSelector) advance() {
+	best := 0
+	for i, weight := range s.weights {
+		s.current[i] += weight
+		if s.current[i] > s.current[best] {
+			best = i
+		}
+	}
+	s.current[best] -= s.total
+	s.selected = best
+}
+
+// newCoinbaseSelectors creates the per-context coinbase selectors from the config.
+func newCoinbaseSelectors(config util.Coinbases) ([]*coinbaseSelector, error) {
+	selectors := make([]*coinbaseSelector, len(contextNames))
+	for i, coinbases := range [][]util.CoinbaseWeight{config.Prime, config.Region, config.Zone} {
+		selector, err := newCoinbaseSelector(coinbases)
+		if err != nil {
+			return nil, fmt.Errorf("%s coinbases: %w", contextNames[i], err)
+		}
+		selectors[i] = selector
+	}
+	return selectors, nil
+}
+
+// coinbaseSelector returns the coinbase selector of the context, nil to keep the node's coinbase.
+func (m *Manager) coinbaseSelector(sliceIndex int) *coinbaseSelector {
+	if sliceIndex >= len(m.coinbases) {
+		return nil
+	}
+	return m.coinbases[sliceIndex]
+}
+
+// requestCoinbase switches the etherbase of the node mining the context to the selected coinbase
+// of the context, so that it builds the coming pending blocks for it. A node that doesn't serve
+// miner_setEtherbase keeps its own coinbase and its pending blocks are mined as they are.
+func (m *Manager) requestCoinbase(sliceIndex int, c *blockClient) {
+	selector := m.coinbaseSelector(sliceIndex)
+	if selector == nil {
+		return
+	}
+	coinbase := selector.Current()
+	var client *rpc.Client
+	m.withLock(func() { client = c.rpc })
+	err := errNotConnected
+	if client != nil {
+		var ok bool
+		if err = client.Call(&ok, "miner_setEtherbase", coinbase); err == nil && !ok {
+			err = errEtherbaseRefused
+		}
+	}
+	selector.setSwitched(coinbase, err == nil)
+	if err != nil {
+		log.Println("Failed to switch the node's etherbase, mining its coinbase", "context", contextNames[sliceIndex], "coinbase", coinbase, "err", err)
+		return
+	}
+	log.Println("Switched the node's etherbase", "context", contextNames[sliceIndex], "coinbase", coinbase)
+}
+
+// advanceCoinbases moves the coinbases of the contexts the header was mined for on and switches
+// their nodes to the next ones.
+func (m *Manager) advanceCoinbases(submitted int, header *types.Header) {
+	var slice miningSlice
+	m.withLock(func() { slice = m.activeSlice() })
+	for i := submitted; i < len(m.coinbases); i++ {
+		if m.coinbases[i] == nil || header.Number[i] == nil {
+			continue
+		}
+		m.coinbases[i].Advance()
+		i, c := i, slice.chains[i]
+		safeGo("requestCoinbase "+contextNames[i], func() { m.requestCoinbase(i, c) })
+	}
+}
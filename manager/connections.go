@@ -0,0 +1,110 @@
+package main
+
+import (
+	"time"
+
+	"github.com/spruce-solutions/go-quai/metrics"
+)
+
+// connectionMetricsInterval is how often the connection gauges of every chain are updated.
+const connectionMetricsInterval = 15 * time.Second
+
+// connectionStats follows the connections to the node of a chain. Once the manager runs it is
+// guarded by the manager lock, like the client.
+type connectionStats struct {
+	connects    int           // connections made, the first one included
+	firstAt     time.Time     // time of the first connection, zero if the node never connected
+	lastAt      time.Time     // time of the last connection
+	connectedAt time.Time     // start of the current connection, zero while disconnected
+	uptime      time.Duration // time connected before the current connection
+}
+
+// connected records a connection to the node, which ends the current one if there is one.
+func (s *connectionStats) connected(now time.Time) {
+	s.disconnected(now)
+	if s.firstAt.IsZero() {
+		s.firstAt = now
+	}
+	s.connects++
+	s.lastAt, s.connectedAt = now, now
+}
+
+// disconnected records that the node went offline.
+func (s *connectionStats) disconnected(now time.Time) {
+	if !s.connectedAt.IsZero() {
+		s.uptime += now.Sub(s.connectedAt)
+		s.connectedAt = time.Time{}
+	}
+}
+
+// reconnects returns the number of connections after the first one.
+func (s *connectionStats) reconnects() int {
+	if s.connects == 0 {
+		return 0
+	}
+	return s.connects - 1
+}
+
+// connectionStatus is the connection history of a chain as served by /status. Durations are in
+// seconds.
+type connectionStatus struct {
+	Uptime        float64    `json:"uptime"`        // time connected since the first connection
+	Reconnects    int        `json:"reconnects"`    // connections after the first one
+	LastReconnect *time.Time `json:"lastReconnect"` // nil if the node never reconnected
+	// SinceReconnect is the time since the last reconnect, or since the first connection if the
+	// node never reconnected.
+	SinceReconnect float64 `json:"sinceReconnect"`
+}
+
+// status returns the connection history at now.
+func (s *connectionStats) status(now time.Time) connectionStatus {
+	status := connectionStatus{Uptime: s.uptime.Seconds(), Reconnects: s.reconnects()}
+	if !s.connectedAt.IsZero() {
+		status.Uptime += now.Sub(s.connectedAt).Seconds()
+	}
+	if s.connects > 1 {
+		last := s.lastAt
+		status.LastReconnect = &last
+	}
+	if !s.lastAt.IsZero() {
+		status.SinceReconnect = now.Sub(s.lastAt).Seconds()
+	}
+	return status
+}
+
+// connectionGauges are the connection gauges of a chain.
+type connectionGauges struct {
+	uptime, reconnects, sinceReconnect metrics.Gauge
+}
+
+// updateConnectionMetrics updates the manager/chains/<chain>/{uptime,reconnects,sincereconnect}
+// gauges of every chain every connectionMetricsInterval.
+func (m *Manager) updateConnectionMetrics() {
+	gauges := make(map[[2]byte]connectionGauges)
+	for _, chain := range m.allChains() {
+		prefix := "manager/chains/" + chainName(chain) + "/"
+		gauges[chain] = connectionGauges{
+			uptime:         newGaugeForced(prefix + "uptime"),
+			reconnects:     newGaugeForced(prefix + "reconnects"),
+			sinceReconnect: newGaugeForced(prefix + "sincereconnect"),
+		}
+	}
+	ticker := time.NewTicker(connectionMetricsInterval)
+	defer ticker.Stop()
+	for {
+		m.withLock(func() {
+			now := time.Now()
+			for chain, gauge := range gauges {
+				status := m.orderedBlockClients.at(chain[:]).stats.status(now)
+				gauge.uptime.Update(int64(status.Uptime))
+				gauge.reconnects.Update(int64(status.Reconnects))
+				gauge.sinceReconnect.Update(int64(status.SinceReconnect))
+			}
+		})
+		select {
+		case <-exit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// fleetCoordinator shares the location of every manager of a fleet through a Redis store, so
+// that the optimizer can spread the fleet over the easiest zones instead of piling all managers
+// onto the single easiest one. Each manager keeps its location under <key>:<id> with a TTL,
+// managers that stop simply expire.
+type fleetCoordinator struct {
+	addr string
+	key  string
+	id   string
+	ttl  time.Duration
+
+	lock   sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// newFleetCoordinator creates a coordinator for the redis://host:port URL. If id is empty the
+// manager is identified by its host name and process ID.
+func newFleetCoordinator(rawURL string, key string, id string, ttl time.Duration) (*fleetCoordinator, error) {
+	addr, err := parseRedisURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		host, _ := os.Hostname()
+		id = host + "-" + strconv.Itoa(os.Getpid())
+	}
+	if ttl < time.Second {
+		return nil, fmt.Errorf("coordination ttl %v too short", ttl)
+	}
+	return &fleetCoordinator{addr: addr, key: key, id: id, ttl: ttl}, nil
+}
+
+// command sends a command to the store and returns its reply, reconnecting if needed.
+func (f *fleetCoordinator) command(args ...string) (interface{}, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.conn == nil {
+		conn, err := net.DialTimeout("tcp", f.addr, workQueueTimeout)
+		if err != nil {
+			return nil, err
+		}
+		f.conn, f.reader = conn, bufio.NewReader(conn)
+	}
+	f.conn.SetDeadline(time.Now().Add(workQueueTimeout))
+	err := writeRESP(f.conn, args...)
+	var reply interface{}
+	if err == nil {
+		reply, err = readRESP(f.reader)
+	}
+	if err != nil {
+		// drop the connection so that the next command reconnects
+		f.conn.Close()
+		f.conn, f.reader = nil, nil
+	}
+	return reply, err
+}
+
+// Register records the location the manager mines, it expires unless registered again
+// within the TTL.
+func (f *fleetCoordinator) Register(location []byte) error {
+	value := fmt.Sprintf("%d,%d", location[0], location[1])
+	_, err := f.command("SET", f.key+":"+f.id, value, "EX", strconv.Itoa(int(f.ttl/time.Second)))
+	return err
+}
+
+// Peers returns the number of other managers of the fleet mining each location.
+func (f *fleetCoordinator) Peers() (map[[2]byte]int, error) {
+	reply, err := f.command("KEYS", f.key+":*")
+	if err != nil {
+		return nil, err
+	}
+	keys, ok := reply.([]interface{})
+	if !ok {
+		return nil, errors.New("unexpected reply listing fleet locations")
+	}
+	args := []string{"MGET"}
+	for _, key := range keys {
+		if key, ok := key.(string); ok && key != f.key+":"+f.id {
+			args = append(args, key)
+		}
+	}
+	peers := make(map[[2]byte]int)
+	if len(args) == 1 {
+		return peers, nil
+	}
+	reply, err = f.command(args...)
+	if err != nil {
+		return nil, err
+	}
+	values, _ := reply.([]interface{})
+	for _, value := range values {
+		// keys that expired since they were listed are nil
+		value, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var region, zone int
+		if _, err := fmt.Sscanf(value, "%d,%d", &region, &zone); err != nil {
+			continue
+		}
+		peers[[2]byte{byte(region), byte(zone)}]++
+	}
+	return peers, nil
+}
+
+// withPeers adds the locations of the other managers of the fleet to the optimizer options.
+// If there is no coordinator or the store can't be read the optimizer selects on its own.
+func (f *fleetCoordinator) withPeers(options optimizerOptions) optimizerOptions {
+	if f == nil {
+		return options
+	}
+	peers, err := f.Peers()
+	if err != nil {
+		log.Println("Failed to read fleet locations, selecting without them", "addr", f.addr, "err", err)
+		return options
+	}
+	options.peers = peers
+	return options
+}
+
+// register records the location, logging failures.
+func (f *fleetCoordinator) register(location []byte) {
+	if f == nil {
+		return
+	}
+	if err := f.Register(location); err != nil {
+		log.Println("Failed to register fleet location", "addr", f.addr, "location", location, "err", err)
+	}
+}
+
+// keepFleetRegistration registers the current location of the manager at a third of the TTL so
+// that it does not expire while the manager runs.
+func (m *Manager) keepFleetRegistration() {
+	ticker := time.NewTicker(m.fleet.ttl / 3)
+	defer ticker.Stop()
+	for {
+		m.fleet.register(m.currentLocation())
+		<-ticker.C
+	}
+}
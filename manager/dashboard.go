@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// difficultyUnits are the suffixes used to print difficulties in human readable form.
+var difficultyUnits = []string{"", "K", "M", "G", "T", "P", "E"}
+
+// formatDifficulty formats a difficulty with a K/M/G/T/P/E suffix, e.g. 1234567 as "1.23M".
+func formatDifficulty(difficulty *big.Int) string {
+	if difficulty == nil {
+		return "nil"
+	}
+	value := new(big.Float).SetInt(difficulty)
+	thousand := big.NewFloat(1000)
+	unit := 0
+	for unit < len(difficultyUnits)-1 && value.Cmp(thousand) >= 0 {
+		value.Quo(value, thousand)
+		unit++
+	}
+	if unit == 0 {
+		return difficulty.String()
+	}
+	return value.Text('f', 2) + difficultyUnits[unit]
+}
+
+// formatDifficulties formats the difficulties of all contexts.
+func formatDifficulties(difficulties []*big.Int) string {
+	formatted := make([]string, len(difficulties))
+	for i, difficulty := range difficulties {
+		formatted[i] = formatDifficulty(difficulty)
+	}
+	return "[" + strings.Join(formatted, " ") + "]"
+}
+
+// dashboard periodically logs a single line summary of what the manager is mining.
+func (m *Manager) dashboard() {
+	for {
+		// read for every line, so that a reload of DashboardInterval applies to the next one
+		time.Sleep(time.Duration(m.cfg().DashboardInterval) * time.Second)
+		var location []byte
+		var numbers []string
+		var difficulties string
+		m.withLock(func() {
+			location = m.location
+			numbers = make([]string, len(m.combinedHeader.Number))
+			for i, number := range m.combinedHeader.Number {
+				numbers[i] = fmt.Sprint(number)
+			}
+			difficulties = formatDifficulties(m.combinedHeader.Difficulty)
+		})
+
+		log.Println("Dashboard", "location", location, "number", "["+strings.Join(numbers, " ")+"]", "difficulty", difficulties, "hashrate", fmt.Sprintf("%.2f H/s", m.engine.Hashrate()))
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+	"github.com/spruce-solutions/go-quai/rpc"
+	"github.com/spruce-solutions/quai-manager/manager/util"
+)
+
+// wsBufferSize is the read and write buffer size of websocket connections to the nodes.
+const wsBufferSize = 1024
+
+// dialOptions configure the connection to the node of a chain.
+type dialOptions struct {
+	userAgent string // User-Agent of HTTP and websocket connections, empty for the default
+	compress  bool   // offer websocket compression, mainly for the large external blocks relayed
+}
+
+// newDialOptions returns the dial options of the chain at the location.
+func newDialOptions(config util.Config, location []byte) dialOptions {
+	return dialOptions{
+		userAgent: config.UserAgent,
+		compress:  containsZone(config.CompressedChains, int(location[0]), int(location[1])),
+	}
+}
+
+// dialNode connects to the node at rawURL. Unless the user agent is empty, HTTP and websocket
+// connections send it as their User-Agent so that node operators can identify the manager.
+// With compress, websocket connections offer per-message compression, which takes effect if the
+// node supports it. HTTP requests are sent as they are: go-quai nodes gzip their responses,
+// which the HTTP client already accepts, but don't decode gzip encoded requests.
+func dialNode(rawURL string, options dialOptions) (*rpc.Client, error) {
+	if options.userAgent == "" && !options.compress {
+		return rpc.Dial(rawURL)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		client, err := rpc.DialHTTP(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		if options.userAgent != "" {
+			client.SetHeader("User-Agent", options.userAgent)
+		}
+		return client, nil
+	case "ws", "wss":
+		dialer := websocket.Dialer{
+			ReadBufferSize:    wsBufferSize,
+			WriteBufferSize:   wsBufferSize,
+			EnableCompression: options.compress,
+		}
+		if options.userAgent != "" {
+			// the dialer has no way to add handshake headers, but it hands the handshake
+			// request to Proxy before sending it; no proxy is used
+			dialer.Proxy = func(req *http.Request) (*url.URL, error) {
+				req.Header.Set("User-Agent", options.userAgent)
+				return nil, nil
+			}
+		}
+		return rpc.DialWebsocketWithDialer(context.Background(), rawURL, "", dialer)
+	}
+	return rpc.Dial(rawURL)
+}
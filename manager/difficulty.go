@@ -0,0 +1,70 @@
+package main
+
+import (
+	"log"
+	"math/big"
+	"sync"
+)
+
+// difficultyWatch keeps the latest difficulty of every zone and requests an immediate optimizer
+// check when a zone other than the mined one drops more than a margin below it.
+type difficultyWatch struct {
+	drop    float64 // relative margin, e.g. 0.2 for 20%
+	recheck chan struct{}
+
+	lock   sync.Mutex
+	latest map[[2]byte]*big.Int
+	below  map[[2]byte]bool // zones that were below the margin at their last block
+}
+
+// newDifficultyWatch creates a watch for the relative margin, nil if drop is not positive.
+func newDifficultyWatch(drop float64) *difficultyWatch {
+	if drop <= 0 {
+		return nil
+	}
+	return &difficultyWatch{
+		drop:    drop,
+		recheck: make(chan struct{}, 1),
+		latest:  make(map[[2]byte]*big.Int),
+		below:   make(map[[2]byte]bool),
+	}
+}
+
+// Recheck returns the channel a check is requested on, nil if the watch is disabled.
+func (w *difficultyWatch) Recheck() <-chan struct{} {
+	if w == nil {
+		return nil
+	}
+	return w.recheck
+}
+
+// Observe records the difficulty of a new block of the zone and requests a check if the zone
+// just dropped below the margin of the current zone. It is only requested once per drop, so
+// that the optimizer isn't rerun on every block while the zone stays easier.
+func (w *difficultyWatch) Observe(zone [2]byte, difficulty *big.Int, current [2]byte) {
+	if w == nil || difficulty == nil {
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.latest[zone] = difficulty
+	if zone == current {
+		return
+	}
+	currentDifficulty, ok := w.latest[current]
+	if !ok {
+		return
+	}
+	threshold, _ := new(big.Float).Mul(new(big.Float).SetInt(currentDifficulty), big.NewFloat(1-w.drop)).Int(nil)
+	below := difficulty.Cmp(threshold) < 0
+	wasBelow := w.below[zone]
+	w.below[zone] = below
+	if !below || wasBelow {
+		return
+	}
+	log.Println("Zone difficulty dropped below the current zone", "zone", zone, "difficulty", formatDifficulty(difficulty), "current", current, "currentDifficulty", formatDifficulty(currentDifficulty))
+	select {
+	case w.recheck <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log"
+	"math/big"
+	"sync/atomic"
+	"time"
+)
+
+// economicCheckInterval is how often the economic gate estimates the reward per hash.
+const economicCheckInterval = time.Minute
+
+// economicStatus is the state of the economic gate as served by /status.
+type economicStatus struct {
+	Paused        bool    `json:"paused"`
+	RewardPerHash float64 `json:"rewardPerHash"`
+	Threshold     float64 `json:"threshold"`
+}
+
+// rewardPerHash estimates the expected reward per hash of mining the difficulties, in zone block
+// rewards, as the sum of the reward of each mined context over its difficulty. A region block
+// is worth regionReward zone blocks. Prime is left out, its blocks are too rare to count. Zero
+// means no difficulty is known yet.
+func rewardPerHash(difficulties []*big.Int, mined func(int) bool, regionReward float64) float64 {
+	rewards := []float64{0, regionReward, 1}
+	var total float64
+	for i, difficulty := range difficulties {
+		if i >= len(rewards) || rewards[i] == 0 || !mined(i) || difficulty == nil || difficulty.Sign() <= 0 {
+			continue
+		}
+		perHash, _ := new(big.Float).Quo(big.NewFloat(rewards[i]), new(big.Float).SetInt(difficulty)).Float64()
+		total += perHash
+	}
+	return total
+}
+
+// economicGate pauses the miner while the expected reward per hash of the combined header is
+// below MinRewardPerHash and resumes it once it is above again, checking every
+// economicCheckInterval.
+func (m *Manager) economicGate() {
+	ticker := time.NewTicker(economicCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		var rate, threshold float64
+		m.withLock(func() {
+			rate = rewardPerHash(m.combinedHeader.Difficulty, m.mineContexts.Enabled, m.cfg().OptimizerRegionReward)
+			m.rewardPerHash = rate
+			threshold = m.cfg().MinRewardPerHash
+		})
+		if rate == 0 {
+			continue
+		}
+
+		paused := rate < threshold
+		if paused == (atomic.LoadInt32(&m.economicPaused) == 1) {
+			continue
+		}
+		if paused {
+			atomic.StoreInt32(&m.economicPaused, 1)
+			log.Println("Economically paused, the reward per hash is below the threshold", "rewardPerHash", rate, "threshold", threshold)
+		} else {
+			atomic.StoreInt32(&m.economicPaused, 0)
+			log.Println("Resuming mining, the reward per hash is above the threshold", "rewardPerHash", rate, "threshold", threshold)
+		}
+		// the miner stops or restarts sealing on the update
+		m.notifyMiner(m.combinedHeader, 2)
+	}
+}
+
+// economicStatus returns the state of the economic gate, nil if it is disabled. The caller must
+// hold m.lock.
+func (m *Manager) economicStatus() *economicStatus {
+	if m.cfg().MinRewardPerHash <= 0 {
+		return nil
+	}
+	return &economicStatus{
+		Paused:        atomic.LoadInt32(&m.economicPaused) == 1,
+		RewardPerHash: m.rewardPerHash,
+		Threshold:     m.cfg().MinRewardPerHash,
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"github.com/spruce-solutions/go-quai/common"
+	"github.com/spruce-solutions/go-quai/common/hexutil"
+	"github.com/spruce-solutions/go-quai/core/types"
+)
+
+// powEngine is the proof-of-work engine the manager seals headers with. It is implemented by
+// blake3.Blake3, which main constructs, and can be replaced by another algorithm or a fake
+// engine that seals instantly.
+type powEngine interface {
+	// SealHeader starts sealing the header and passes any solution to results until stop is
+	// closed.
+	SealHeader(header *types.Header, results chan<- *types.HeaderBundle, stop <-chan struct{}) error
+	// SealHash returns the hash of the header that is sealed, which excludes the nonce.
+	SealHash(header *types.Header) common.Hash
+	// GetDifficultyOrder returns the highest context whose difficulty the sealed header meets.
+	GetDifficultyOrder(header *types.Header) (int, error)
+	// Hashrate returns the local hashrate in hashes per second.
+	Hashrate() float64
+	// SubmitHashrate reports the hashrate of a remote sealer with the given id.
+	SubmitHashrate(rate hexutil.Uint64, id common.Hash) bool
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spruce-solutions/go-quai/common"
+	"github.com/spruce-solutions/go-quai/common/hexutil"
+	"github.com/spruce-solutions/go-quai/core/types"
+)
+
+// fakeEngine is a powEngine that only seals when told to. Every seal the mining loop starts is
+// passed on seals, solve completes it.
+type fakeEngine struct {
+	seals chan *fakeSeal
+	order int // context every sealed header is reported to meet
+}
+
+// fakeSeal is a seal started on a fakeEngine.
+type fakeSeal struct {
+	header  *types.Header
+	results chan<- *types.HeaderBundle
+	stop    <-chan struct{}
+}
+
+func newFakeEngine() *fakeEngine {
+	return &fakeEngine{seals: make(chan *fakeSeal, resultQueueSize), order: 2}
+}
+
+func (e *fakeEngine) SealHeader(header *types.Header, results chan<- *types.HeaderBundle, stop <-chan struct{}) error {
+	e.seals <- &fakeSeal{header: header, results: results, stop: stop}
+	return nil
+}
+
+func (e *fakeEngine) SealHash(header *types.Header) common.Hash {
+	work := *header
+	work.Nonce = types.BlockNonce{}
+	return work.Hash()
+}
+
+func (e *fakeEngine) GetDifficultyOrder(header *types.Header) (int, error) {
+	return e.order, nil
+}
+
+func (e *fakeEngine) Hashrate() float64 { return 0 }
+
+func (e *fakeEngine) SubmitHashrate(rate hexutil.Uint64, id common.Hash) bool { return true }
+
+// next returns the next seal the mining loop started.
+func (e *fakeEngine) next(t *testing.T) *fakeSeal {
+	t.Helper()
+	select {
+	case seal := <-e.seals:
+		return seal
+	case <-time.After(5 * time.Second):
+		t.Fatal("no seal started")
+		return nil
+	}
+}
+
+// solve reports the header of the seal as sealed with the nonce, like the engine does with a
+// copy of the header it was given.
+func (s *fakeSeal) solve(nonce uint64, order int) {
+	header := *s.header
+	header.Nonce = types.EncodeNonce(nonce)
+	s.results <- &types.HeaderBundle{Header: &header, Context: order}
+}
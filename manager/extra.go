@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spruce-solutions/go-quai/common/hexutil"
+	"github.com/spruce-solutions/go-quai/params"
+)
+
+// parseExtraData returns the extra data a 0x prefixed hex value or a plain string stands for,
+// nil if it is empty. Values longer than the protocol allows are rejected, as the nodes would
+// reject every block mined with them.
+func parseExtraData(value string) ([]byte, error) {
+	if value == "" {
+		return nil, nil
+	}
+	extra := []byte(value)
+	if strings.HasPrefix(value, "0x") {
+		decoded, err := hexutil.Decode(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid extra data %q: %w", value, err)
+		}
+		extra = decoded
+	}
+	if uint64(len(extra)) > params.MaximumExtraDataSize {
+		return nil, fmt.Errorf("extra data is %d bytes, at most %d are allowed", len(extra), params.MaximumExtraDataSize)
+	}
+	return extra, nil
+}
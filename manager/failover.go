@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/spruce-solutions/go-quai/ethclient"
+	"github.com/spruce-solutions/go-quai/rpc"
+	"github.com/spruce-solutions/quai-manager/manager/util"
+)
+
+// failoverCheckInterval is how often the chains of the mined and failover locations are checked.
+const failoverCheckInterval = 10 * time.Second
+
+// failoverLocations returns the primary location followed by the configured failover locations,
+// in order of preference.
+func failoverLocations(primary []byte, failover [][]int) [][]byte {
+	locations := [][]byte{primary}
+	for _, location := range failover {
+		if len(location) != 2 {
+			log.Println("Ignoring invalid failover location", "location", location)
+			continue
+		}
+		locations = append(locations, []byte{byte(location[0]), byte(location[1])})
+	}
+	return locations
+}
+
+// startReconnect starts the reconnect supervisor unless it is running already.
+func (m *Manager) startReconnect() {
+	if atomic.CompareAndSwapInt32(&m.reconnecting, 0, 1) {
+		safeGo("reconnectChains", func() { m.reconnectChains() })
+	}
+}
+
+// locationReachable reports whether the region and zone of the location answer. Chains that
+// stopped answering are marked offline and handed to the reconnect supervisor.
+func (m *Manager) locationReachable(location []byte) bool {
+	states := m.chainStates()
+	if !sliceOnline(states, location, false) {
+		if len(location) == 2 && location[0] >= 1 && int(location[0]) <= len(m.orderedBlockClients.regions) {
+			// the supervisor may have returned while the chain went offline
+			m.startReconnect()
+		}
+		return false
+	}
+	chains := []*blockClient{
+		m.orderedBlockClients.regions[location[0]-1],
+		m.orderedBlockClients.zones[location[0]-1][location[1]-1],
+	}
+	for i, state := range []chainState{states.regions[location[0]-1], states.zones[location[0]-1][location[1]-1]} {
+		if !checkConnection(state) {
+			// leave a client the reconnect supervisor replaced meanwhile
+			c := chains[i]
+			m.withLock(func() {
+				if c.client == state.client {
+					c.disconnect()
+				}
+			})
+			m.startReconnect()
+			return false
+		}
+	}
+	return true
+}
+
+// failover keeps mining the first reachable location of the primary and the FailoverLocations.
+// It switches to the next reachable location when the mined one goes offline and back once a
+// more preferred one, eventually the primary, is reachable again.
+func (m *Manager) failover(primary []byte) {
+	locations := failoverLocations(primary, m.cfg().FailoverLocations)
+	ticker := time.NewTicker(failoverCheckInterval)
+	defer ticker.Stop()
+	stranded := false
+	for {
+		select {
+		case <-exit:
+			return
+		case <-ticker.C:
+		}
+		var target []byte
+		for _, location := range locations {
+			if m.locationReachable(location) {
+				target = location
+				break
+			}
+		}
+		if target == nil {
+			if !stranded {
+				log.Println("No failover location is reachable, keeping the current location", "location", m.location)
+			}
+			stranded = true
+			continue
+		}
+		stranded = false
+		if bytes.Equal(target, m.location) {
+			continue
+		}
+		if bytes.Equal(target, primary) {
+			log.Println("Failing back to the primary location", "location", target, "from", m.location)
+		} else {
+			log.Println("Failing over to location", "location", target, "from", m.location)
+		}
+		m.switchLocation(target)
+	}
+}
+
+// primeURLs returns the configured prime node URLs in order of preference, PrimeURL first.
+func primeURLs(config util.Config) []string {
+	var urls []string
+	for _, url := range append([]string{config.PrimeURL}, config.PrimeBackupURLs...) {
+		if url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// dialPrime connects to the first prime node of the urls that answers and returns its URL.
+func dialPrime(urls []string, options dialOptions) (string, *rpc.Client, error) {
+	var err error
+	for _, url := range urls {
+		var client *rpc.Client
+		if client, err = dialNode(url, options); err == nil {
+			return url, client, nil
+		}
+		log.Println("Unable to connect to node:", "Prime", util.RedactURL(url), "err", err)
+	}
+	return "", nil, err
+}
+
+// failoverPrime checks the prime node every failoverCheckInterval and switches to the first of
+// PrimeURL and PrimeBackupURLs that answers when it stops answering.
+func (m *Manager) failoverPrime() {
+	urls := primeURLs(*m.cfg())
+	options := newDialOptions(*m.cfg(), []byte{0, 0})
+	ticker := time.NewTicker(failoverCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exit:
+			return
+		case <-ticker.C:
+		}
+		prime := m.orderedBlockClients.prime
+		var available bool
+		var current *ethclient.Client
+		var currentURL string
+		m.withLock(func() { available, current, currentURL = prime.available, prime.client, prime.redactedURL() })
+		if available && current != nil {
+			_, err := current.HeaderByNumber(context.Background(), nil)
+			if err == nil {
+				continue
+			}
+			log.Println("Error: connection lost", "url", currentURL, "err", err)
+		}
+		url, client, err := dialPrime(urls, options)
+		if err != nil {
+			m.withLock(prime.disconnect)
+			continue
+		}
+		m.switchPrime(url, client, options)
+	}
+}
+
+// switchPrime replaces the connection to the prime node in place, so that the relays and lookups
+// use it from now on, and starts the prime subscriptions on it. The pending block subscription
+// of the old node is stopped and the old connection is closed to stop the other subscriptions.
+func (m *Manager) switchPrime(url string, client *rpc.Client, options dialOptions) {
+	prime := m.orderedBlockClients.prime
+	var old *rpc.Client
+	var from string
+	var primeClient *ethclient.Client
+	var done <-chan struct{}
+	pool := dialPool(url, m.cfg().RelayPoolSizes.Prime, options)
+	m.withLock(func() {
+		old = prime.rpc
+		from = prime.redactedURL()
+		prime.url = url
+		prime.connect(client)
+		prime.pool = pool
+		primeClient = prime.client
+		if m.doneCh != nil {
+			done = m.primeSubscriptionDone(m.doneCh)
+		}
+	})
+	if old != nil && old != client {
+		old.Close()
+	}
+	log.Println("Switched prime node", "url", util.RedactURL(url), "from", from)
+
+	m.subscribeChain(primeClient, 0, []byte{0, 0})
+	if done != nil {
+		// mining, the pending block subscription of prime restarts with the location
+		safeGo("subscribePendingHeader prime", func() { m.subscribePendingHeader(primeClient, 0, done) })
+		safeGo("fetchPendingBlocks prime", func() { m.fetchPendingBlocks(primeClient, 0) })
+	}
+}
+
+// primeSubscriptionDone stops the running pending block subscription of prime and returns the
+// done channel of the next one, closed once either the location or the prime node changes. The
+// caller must hold m.lock.
+func (m *Manager) primeSubscriptionDone(locationDone <-chan struct{}) <-chan struct{} {
+	if m.primeDoneCh != nil {
+		close(m.primeDoneCh)
+	}
+	primeDone := make(chan struct{})
+	m.primeDoneCh = primeDone
+	done := make(chan struct{})
+	goRecovered("primeSubscriptionDone", func() {
+		select {
+		case <-locationDone:
+		case <-primeDone:
+		}
+		close(done)
+	})
+	return done
+}
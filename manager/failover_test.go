@@ -0,0 +1,38 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// pendingSubscribers returns the number of subscribePendingHeader goroutines running.
+func pendingSubscribers() int {
+	stacks := make([]byte, 1<<20)
+	stacks = stacks[:runtime.Stack(stacks, true)]
+	return strings.Count(string(stacks), ").subscribePendingHeader(")
+}
+
+func TestSwitchPrimeStopsOldSubscription(t *testing.T) {
+	network := newTestNetwork(t)
+	backup, backupNode := newTestClient(t, newTestHead(1), false)
+	backupNode.pending = newTestTemplate([]byte{0, 0})
+	m := newTestManager(newFakeEngine(), []byte{1, 1})
+	network.attach(t, m)
+	go m.loopGlobalBlock()
+
+	m.subscribeAllPendingBlocks()
+	eventually(t, "the subscriptions of [1 1]", func() bool { return network.subscriptionsAt(m, []byte{1, 1}) })
+	subscribers := pendingSubscribers()
+
+	m.switchPrime("inproc://backup", backup.rpc, dialOptions{})
+	network.nodes[[2]byte{0, 0}] = backupNode
+	eventually(t, "the subscription of the backup prime", func() bool { return atomic.LoadInt32(&backupNode.pendingSubscriptions) == 1 })
+	eventually(t, "the subscriber of the old prime to stop", func() bool { return pendingSubscribers() == subscribers })
+
+	// a location switch stops the subscription of the backup prime too
+	m.switchLocation([]byte{2, 2})
+	eventually(t, "the subscriptions of [2 2]", func() bool { return network.subscriptionsAt(m, []byte{2, 2}) })
+	eventually(t, "one subscriber per context", func() bool { return pendingSubscribers() == subscribers })
+}
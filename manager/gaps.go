@@ -0,0 +1,128 @@
+package main
+
+import (
+	"log"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// minedGapCheckInterval is how often the gaps since the last mined blocks are compared with the
+// expected time to mine a block.
+const minedGapCheckInterval = time.Minute
+
+// minedGapAlert is the JSON document posted to the alert webhook for a context without a mined
+// block for longer than MinedGapAlert times the expected time.
+type minedGapAlert struct {
+	Context   string    `json:"context"`
+	LastMined time.Time `json:"lastMined"`
+	Gap       float64   `json:"gap"`      // seconds since the last mined block
+	Expected  float64   `json:"expected"` // expected seconds to mine a block
+}
+
+// minedGapStatus is the last mined block of a context as served by /status.
+type minedGapStatus struct {
+	LastMined *time.Time `json:"lastMined"` // nil if none was mined since the start
+	Gap       float64    `json:"gap"`
+	Expected  float64    `json:"expected"` // 0 while the hashrate or difficulty is unknown
+}
+
+// minedGaps records when the last block of every context was mined.
+type minedGaps struct {
+	lock    sync.Mutex
+	start   time.Time    // the gaps count from here until a context mines its first block
+	last    [3]time.Time // zero until the context mined a block
+	alerted [3]bool      // whether the current gap was alerted
+}
+
+// newMinedGaps returns gaps counting from now.
+func newMinedGaps() *minedGaps {
+	return &minedGaps{start: time.Now()}
+}
+
+// Record records a block mined in the context. It is a block of the lower contexts too.
+func (g *minedGaps) Record(mined int) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	now := time.Now()
+	for i := mined; i < len(g.last); i++ {
+		g.last[i] = now
+		g.alerted[i] = false
+	}
+}
+
+// gap returns the time of the last block mined in the context, zero if none was, and the time
+// since then or since the start. The caller must hold g.lock.
+func (g *minedGaps) gap(difficultyContext int) (time.Time, time.Duration) {
+	last := g.last[difficultyContext]
+	if last.IsZero() {
+		return last, time.Since(g.start)
+	}
+	return last, time.Since(last)
+}
+
+// expectedBlockTime returns the expected time to mine a block of the difficulty at the
+// hashrate, each hash meets it with a probability of 1/difficulty. Zero if either is unknown.
+func expectedBlockTime(difficulty *big.Int, hashrate float64) time.Duration {
+	if difficulty == nil || difficulty.Sign() <= 0 || hashrate <= 0 {
+		return 0
+	}
+	hashes, _ := new(big.Float).SetInt(difficulty).Float64()
+	return time.Duration(hashes / hashrate * float64(time.Second))
+}
+
+// minedGapStatus returns the last mined block of every context. The caller must hold m.lock.
+func (m *Manager) minedGapStatus() []minedGapStatus {
+	hashrate := m.engine.Hashrate()
+	m.minedGaps.lock.Lock()
+	defer m.minedGaps.lock.Unlock()
+	statuses := make([]minedGapStatus, len(contextNames))
+	for i := range statuses {
+		last, gap := m.minedGaps.gap(i)
+		if !last.IsZero() {
+			statuses[i].LastMined = &last
+		}
+		statuses[i].Gap = gap.Seconds()
+		if i < len(m.combinedHeader.Difficulty) {
+			statuses[i].Expected = expectedBlockTime(m.combinedHeader.Difficulty[i], hashrate).Seconds()
+		}
+	}
+	return statuses
+}
+
+// watchMinedGaps warns, and posts to AlertWebhook if it is set, once per gap when a mined
+// context has not mined a block for MinedGapAlert times the expected time at the current
+// hashrate and difficulty.
+func (m *Manager) watchMinedGaps() {
+	ticker := time.NewTicker(minedGapCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		var statuses []minedGapStatus
+		var multiple float64
+		m.withLock(func() {
+			statuses = m.minedGapStatus()
+			multiple = m.cfg().MinedGapAlert
+		})
+
+		for i, status := range statuses {
+			if status.Expected == 0 || status.Gap < multiple*status.Expected || !m.mineContexts.Enabled(i) {
+				continue
+			}
+			m.minedGaps.lock.Lock()
+			alerted := m.minedGaps.alerted[i]
+			m.minedGaps.alerted[i] = true
+			m.minedGaps.lock.Unlock()
+			if alerted {
+				continue
+			}
+			log.Println("No block mined for longer than expected", "context", contextNames[i], "gap", time.Duration(status.Gap*float64(time.Second)), "expected", time.Duration(status.Expected*float64(time.Second)), "multiple", multiple)
+			if m.cfg().AlertWebhook != "" {
+				alert := &minedGapAlert{Context: contextNames[i], Gap: status.Gap, Expected: status.Expected}
+				if status.LastMined != nil {
+					alert.LastMined = *status.LastMined
+				}
+				postAlert(m.cfg().AlertWebhook, alert)
+			}
+		}
+	}
+}
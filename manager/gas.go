@@ -0,0 +1,51 @@
+package main
+
+import (
+	"sync"
+)
+
+// gasUsedWeight is the weight of the newest block in the moving average of the gas used.
+const gasUsedWeight = 0.2
+
+// gasTracker keeps a moving average of the gas used by the recent blocks of each chain, so
+// that the optimizer can tell which zones are currently producing fuller blocks.
+type gasTracker struct {
+	lock   sync.Mutex
+	recent map[[2]byte]float64
+}
+
+func newGasTracker() *gasTracker {
+	return &gasTracker{recent: make(map[[2]byte]float64)}
+}
+
+// chainLocation returns the location of the chain of the given context a block at location
+// belongs to, [0, 0] for prime, [region, 0] for a region and [region, zone] for a zone.
+func chainLocation(location []byte, difficultyContext int) [2]byte {
+	var chain [2]byte
+	for i := 0; i < difficultyContext && i < len(location); i++ {
+		chain[i] = location[i]
+	}
+	return chain
+}
+
+// Observe adds the gas used by a new block of the chain to its average.
+func (t *gasTracker) Observe(chain [2]byte, gasUsed uint64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if recent, ok := t.recent[chain]; ok {
+		t.recent[chain] = recent + gasUsedWeight*(float64(gasUsed)-recent)
+	} else {
+		t.recent[chain] = float64(gasUsed)
+	}
+}
+
+// Recent returns the average gas used by the recent blocks of the chain, if any were observed.
+func (t *gasTracker) Recent(chain [2]byte) (float64, bool) {
+	if t == nil {
+		return 0, false
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	recent, ok := t.recent[chain]
+	return recent, ok
+}
@@ -0,0 +1,21 @@
+package main
+
+import "github.com/spruce-solutions/go-quai/core/types"
+
+// coalescedHeadCounters count the new heads skipped for a later head of the same chain with
+// CoalesceNewHeads, indexed by the context of the chain.
+var coalescedHeadCounters = newContextCounters("manager/heads/coalesced")
+
+// latestHead returns the last of the heads waiting in the channel, or head if none are waiting.
+// The heads it skips are counted for the context.
+func latestHead(heads chan *types.Header, head *types.Header, difficultyContext int) *types.Header {
+	for {
+		select {
+		case next := <-heads:
+			coalescedHeadCounters[difficultyContext].Inc(1)
+			head = next
+		default:
+			return head
+		}
+	}
+}
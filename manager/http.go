@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math/big"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/spruce-solutions/go-quai/common"
+	"github.com/spruce-solutions/go-quai/common/hexutil"
+	"github.com/spruce-solutions/go-quai/core/types"
+	"github.com/spruce-solutions/go-quai/metrics"
+	"github.com/spruce-solutions/go-quai/metrics/prometheus"
+)
+
+// contextFlags holds the per-context mining switches that can be toggled at runtime.
+type contextFlags struct {
+	enabled [3]int32
+}
+
+// newContextFlags creates the switches from the configured prime, region and zone flags.
+func newContextFlags(prime, region, zone bool) *contextFlags {
+	f := &contextFlags{}
+	f.Set(0, prime)
+	f.Set(1, region)
+	f.Set(2, zone)
+	return f
+}
+
+// Enabled reports whether blocks of the given context are submitted.
+func (f *contextFlags) Enabled(sliceIndex int) bool {
+	return atomic.LoadInt32(&f.enabled[sliceIndex]) == 1
+}
+
+// Set enables or disables the submission of blocks of the given context.
+func (f *contextFlags) Set(sliceIndex int, enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&f.enabled[sliceIndex], value)
+}
+
+// contextsStatus is the JSON representation of the context switches.
+type contextsStatus struct {
+	Prime  *bool `json:"prime,omitempty"`
+	Region *bool `json:"region,omitempty"`
+	Zone   *bool `json:"zone,omitempty"`
+}
+
+func (f *contextFlags) status() contextsStatus {
+	prime, region, zone := f.Enabled(0), f.Enabled(1), f.Enabled(2)
+	return contextsStatus{Prime: &prime, Region: &region, Zone: &zone}
+}
+
+// managerStatus is the JSON document served by /status.
+type managerStatus struct {
+	Location []int          `json:"location"`
+	Mining   bool           `json:"mining"`
+	Contexts contextsStatus `json:"contexts"`
+	Numbers  []string       `json:"numbers"`
+	Hashrate float64        `json:"hashrate"`
+
+	Submissions submissionsStatus `json:"submissions"`
+	Chains      []chainStatus     `json:"chains"`
+	Pending     []pendingStatus   `json:"pending"`
+	Economic    *economicStatus   `json:"economic,omitempty"`
+	LastMined   []minedGapStatus  `json:"lastMined"`
+}
+
+// pendingStatus describes the pending block being mined in a context.
+type pendingStatus struct {
+	GasUsed       uint64  `json:"gasUsed"`
+	Transactions  int     `json:"transactions"`
+	RecentGasUsed float64 `json:"recentGasUsed"`
+}
+
+// chainStatus is the node of a chain as served by /status.
+type chainStatus struct {
+	Location   []int            `json:"location"`
+	URL        string           `json:"url"`
+	Available  bool             `json:"available"`
+	Connection connectionStatus `json:"connection"`
+}
+
+func newChainStatus(c *blockClient, location ...int) chainStatus {
+	return chainStatus{Location: location, URL: c.redactedURL(), Available: c.available, Connection: c.stats.status(time.Now())}
+}
+
+// submissionsStatus are the submission counts of mined and relayed external blocks.
+type submissionsStatus struct {
+	Mined    map[string]contextSubmissions `json:"mined"`
+	External map[string]contextSubmissions `json:"external"`
+}
+
+// status takes a snapshot of the state of the manager.
+func (m *Manager) status() managerStatus {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	status := managerStatus{
+		Mining:   m.cfg().Mine,
+		Contexts: m.mineContexts.status(),
+		Hashrate: m.engine.Hashrate(),
+		Submissions: submissionsStatus{
+			Mined:    m.minedSubmissions.status(),
+			External: m.externalSubmissions.status(),
+		},
+		Economic:  m.economicStatus(),
+		LastMined: m.minedGapStatus(),
+	}
+	for _, loc := range m.location {
+		status.Location = append(status.Location, int(loc))
+	}
+	status.Chains = append(status.Chains, newChainStatus(m.orderedBlockClients.prime, 0, 0))
+	for i, region := range m.orderedBlockClients.regions {
+		status.Chains = append(status.Chains, newChainStatus(region, i+1, 0))
+	}
+	for i, zones := range m.orderedBlockClients.zones {
+		for j, zone := range zones {
+			status.Chains = append(status.Chains, newChainStatus(zone, i+1, j+1))
+		}
+	}
+	for i, pending := range m.pendingBlocks {
+		var info pendingStatus
+		if pending != nil {
+			info.GasUsed = pending.Header().GasUsed[i]
+			info.Transactions = len(pending.Transactions())
+		}
+		info.RecentGasUsed, _ = m.gasUsed.Recent(chainLocation(m.location, i))
+		status.Pending = append(status.Pending, info)
+	}
+	for _, number := range m.combinedHeader.Number {
+		if number == nil {
+			status.Numbers = append(status.Numbers, "")
+		} else {
+			status.Numbers = append(status.Numbers, number.String())
+		}
+	}
+	return status
+}
+
+// headerSnapshot is the combined header as served by /header. The fields are named and encoded
+// like the headers the nodes return over RPC, so that the two can be diffed.
+type headerSnapshot struct {
+	ParentHash        []common.Hash    `json:"parentHash"`
+	UncleHash         []common.Hash    `json:"sha3Uncles"`
+	Coinbase          []common.Address `json:"miner"`
+	Root              []common.Hash    `json:"stateRoot"`
+	TxHash            []common.Hash    `json:"transactionsRoot"`
+	ReceiptHash       []common.Hash    `json:"receiptsRoot"`
+	Bloom             []types.Bloom    `json:"logsBloom"`
+	Difficulty        []*hexutil.Big   `json:"difficulty"`
+	NetworkDifficulty []*hexutil.Big   `json:"networkDifficulty"`
+	Number            []*hexutil.Big   `json:"number"`
+	GasLimit          []hexutil.Uint64 `json:"gasLimit"`
+	GasUsed           []hexutil.Uint64 `json:"gasUsed"`
+	Time              hexutil.Uint64   `json:"timestamp"`
+	Extra             []hexutil.Bytes  `json:"extraData"`
+	Nonce             types.BlockNonce `json:"nonce"`
+	Location          hexutil.Bytes    `json:"location"`
+	BaseFee           []*hexutil.Big   `json:"baseFeePerGas"`
+
+	Hash     common.Hash `json:"hash"`
+	SealHash common.Hash `json:"sealHash"`
+}
+
+// bigs converts the numbers to their hex encoding, keeping nil entries as null.
+func bigs(values []*big.Int) []*hexutil.Big {
+	encoded := make([]*hexutil.Big, len(values))
+	for i, value := range values {
+		encoded[i] = (*hexutil.Big)(value)
+	}
+	return encoded
+}
+
+func uint64s(values []uint64) []hexutil.Uint64 {
+	encoded := make([]hexutil.Uint64, len(values))
+	for i, value := range values {
+		encoded[i] = hexutil.Uint64(value)
+	}
+	return encoded
+}
+
+// newHeaderSnapshot encodes the header, the snapshot shares its slices so the header must not
+// change while it is in use.
+func newHeaderSnapshot(header *types.Header, sealHash common.Hash) headerSnapshot {
+	extra := make([]hexutil.Bytes, len(header.Extra))
+	for i, value := range header.Extra {
+		extra[i] = value
+	}
+	return headerSnapshot{
+		ParentHash:        header.ParentHash,
+		UncleHash:         header.UncleHash,
+		Coinbase:          header.Coinbase,
+		Root:              header.Root,
+		TxHash:            header.TxHash,
+		ReceiptHash:       header.ReceiptHash,
+		Bloom:             header.Bloom,
+		Difficulty:        bigs(header.Difficulty),
+		NetworkDifficulty: bigs(header.NetworkDifficulty),
+		Number:            bigs(header.Number),
+		GasLimit:          uint64s(header.GasLimit),
+		GasUsed:           uint64s(header.GasUsed),
+		Time:              hexutil.Uint64(header.Time),
+		Extra:             extra,
+		Nonce:             header.Nonce,
+		Location:          header.Location,
+		BaseFee:           bigs(header.BaseFee),
+		Hash:              header.Hash(),
+		SealHash:          sealHash,
+	}
+}
+
+// serveHTTP starts the status, control and metrics endpoints on the given address.
+func (m *Manager) serveHTTP(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", m.handleStatus)
+	mux.HandleFunc("/contexts", m.handleContexts)
+	mux.HandleFunc("/abort", m.handleAbort)
+	mux.HandleFunc("/header", m.handleHeader)
+	mux.Handle("/metrics", prometheus.Handler(metrics.DefaultRegistry))
+
+	log.Println("Starting HTTP endpoint", "addr", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Println("HTTP endpoint stopped", "addr", addr, "err", err)
+	}
+}
+
+func (m *Manager) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, m.status())
+}
+
+// handleContexts returns the context switches on GET and updates the given ones on POST,
+// e.g. {"prime":true,"region":false,"zone":true}.
+func (m *Manager) handleContexts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var update contextsStatus
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for i, enabled := range []*bool{update.Prime, update.Region, update.Zone} {
+			if enabled != nil {
+				m.mineContexts.Set(i, *enabled)
+				log.Println("Mining context updated", "context", contextNames[i], "enabled", *enabled)
+			}
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, m.mineContexts.status())
+}
+
+// handleHeader returns a snapshot of the combined header being mined, copied under the lock,
+// together with its seal hash.
+func (m *Manager) handleHeader(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var header *types.Header
+	m.withLock(func() { header = copyHeader(m.combinedHeader) })
+	writeJSON(w, newHeaderSnapshot(header, m.engine.SealHash(header)))
+}
+
+// handleAbort cancels the mined block submissions in flight on POST and returns them.
+func (m *Manager) handleAbort(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	aborted := m.submissions.CancelAll()
+	log.Println("Aborting mined block submissions", "count", len(aborted))
+	writeJSON(w, aborted)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("Failed to write HTTP response", "err", err)
+	}
+}
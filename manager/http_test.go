@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spruce-solutions/go-quai/common/hexutil"
+	"github.com/spruce-solutions/go-quai/core/types"
+)
+
+func TestHandleHeaderWhileUpdated(t *testing.T) {
+	m := newTestManager(newFakeEngine(), []byte{1, 1})
+	m.combinedHeader = types.NewEmptyHeader()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := int64(1); i <= 200; i++ {
+			m.updateCombinedHeader(newTestHead(i), int(i)%len(contextNames))
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		recorder := httptest.NewRecorder()
+		m.handleHeader(recorder, httptest.NewRequest(http.MethodGet, "/header", nil))
+		var snapshot struct {
+			Number []*hexutil.Big `json:"number"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &snapshot); err != nil {
+			t.Fatal(err)
+		}
+		if len(snapshot.Number) != len(contextNames) {
+			t.Fatalf("snapshot has %d numbers", len(snapshot.Number))
+		}
+	}
+	<-done
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/spruce-solutions/go-quai/ethclient"
+)
+
+// nodeIdentity is what a node reports about the chain it serves.
+type nodeIdentity struct {
+	chainID  *big.Int
+	location []byte
+}
+
+// queryNodeIdentity asks the client for its chain ID and the location of its latest header.
+func queryNodeIdentity(client *ethclient.Client) (*nodeIdentity, error) {
+	chainID, err := client.ChainID(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	header, err := client.HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &nodeIdentity{chainID: chainID, location: header.Location}, nil
+}
+
+// verifyNodeIdentities checks that every connected node serves the chain its URL is configured
+// for: all nodes must report the chain ID of prime, region nodes must report blocks of their
+// region and zone nodes blocks of their zone. Nodes still at genesis report no location and
+// only have their chain ID checked.
+func verifyNodeIdentities(clients orderedBlockClients) error {
+	if !clients.prime.available {
+		return nil
+	}
+	prime, err := queryNodeIdentity(clients.prime.client)
+	if err != nil {
+		return fmt.Errorf("prime: %v", err)
+	}
+
+	verify := func(name string, client *ethclient.Client, expected []byte) error {
+		identity, err := queryNodeIdentity(client)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		if identity.chainID.Cmp(prime.chainID) != 0 {
+			return fmt.Errorf("%s reports chain ID %v, prime reports %v", name, identity.chainID, prime.chainID)
+		}
+		if len(identity.location) < len(expected) {
+			return nil
+		}
+		for i, loc := range expected {
+			if identity.location[i] != loc {
+				return fmt.Errorf("%s serves location %v, expected %v", name, identity.location, expected)
+			}
+		}
+		return nil
+	}
+
+	for i, region := range clients.regions {
+		if !region.available {
+			continue
+		}
+		if err := verify(fmt.Sprintf("region %d", i+1), region.client, []byte{byte(i + 1)}); err != nil {
+			return err
+		}
+	}
+	for i, zoneClients := range clients.zones {
+		for j, zone := range zoneClients {
+			if !zone.available {
+				continue
+			}
+			if err := verify(fmt.Sprintf("zone %d-%d", i+1, j+1), zone.client, []byte{byte(i + 1), byte(j + 1)}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/spruce-solutions/go-quai/common"
+	"github.com/spruce-solutions/go-quai/ethclient"
+)
+
+const (
+	// syncLagCheckInterval is how often the sync lag of every chain is checked.
+	syncLagCheckInterval = 15 * time.Second
+	// syncLagCheckTimeout bounds a single sync status request.
+	syncLagCheckTimeout = 5 * time.Second
+)
+
+// syncLags holds the latest sync lag of every chain, the number of blocks its node is behind
+// the highest block it knows of.
+type syncLags struct {
+	lock sync.Mutex
+	lags map[[2]byte]uint64
+}
+
+func newSyncLags() *syncLags {
+	return &syncLags{lags: make(map[[2]byte]uint64)}
+}
+
+// Lag returns the latest sync lag of the chain at the location, 0 if it is synced or unknown.
+func (l *syncLags) Lag(location []byte) uint64 {
+	if len(location) < 2 {
+		return 0
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.lags[[2]byte{location[0], location[1]}]
+}
+
+// set records the sync lag of the chain and returns the previous one.
+func (l *syncLags) set(chain [2]byte, lag uint64) uint64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	previous := l.lags[chain]
+	l.lags[chain] = lag
+	return previous
+}
+
+// watchSyncLags checks the sync status of every connected chain every syncLagCheckInterval and
+// logs when a chain falls more than MaxRelaySyncLag blocks behind and when it catches up again.
+func (m *Manager) watchSyncLags() {
+	ticker := time.NewTicker(syncLagCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		limit := uint64(m.cfg().MaxRelaySyncLag)
+		for _, chain := range m.allChains() {
+			c := m.orderedBlockClients.at(chain[:])
+			var client *ethclient.Client
+			var available bool
+			m.withLock(func() { client, available = c.client, c.available })
+			if client == nil || !available {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), syncLagCheckTimeout)
+			progress, err := client.SyncProgress(ctx)
+			cancel()
+			if err != nil {
+				continue
+			}
+			var lag uint64
+			if progress != nil && progress.HighestBlock > progress.CurrentBlock {
+				lag = progress.HighestBlock - progress.CurrentBlock
+			}
+			previous := m.syncLags.set(chain, lag)
+			if lag > limit && previous <= limit {
+				log.Println("Chain is lagging, pausing external block relays to it", "chain", chain, "lag", lag, "max", limit)
+			} else if lag <= limit && previous > limit {
+				log.Println("Chain caught up, resuming external block relays to it", "chain", chain, "lag", lag)
+			}
+		}
+	}
+}
+
+// allChains returns the locations of all chains.
+func (m *Manager) allChains() [][2]byte {
+	chains := [][2]byte{{0, 0}}
+	for i := range m.orderedBlockClients.regions {
+		chains = append(chains, [2]byte{byte(i + 1), 0})
+		for j := range m.orderedBlockClients.zones[i] {
+			chains = append(chains, [2]byte{byte(i + 1), byte(j + 1)})
+		}
+	}
+	return chains
+}
+
+// withoutLagging returns the targets whose chains are at most MaxRelaySyncLag blocks behind,
+// logging the skipped ones. It returns the targets as they are if the check is disabled.
+func (m *Manager) withoutLagging(targets []relayTarget, hash common.Hash) []relayTarget {
+	limit := uint64(m.cfg().MaxRelaySyncLag)
+	if limit == 0 {
+		return targets
+	}
+	kept := targets[:0:0]
+	for _, target := range targets {
+		if lag := m.syncLags.Lag(target.location); lag > limit {
+			log.Println("Skipping external block relay to lagging chain", "target", target.location, "hash", hash, "lag", lag)
+			continue
+		}
+		kept = append(kept, target)
+	}
+	return kept
+}
@@ -5,15 +5,16 @@ import (
 	"context"
 	"encoding/binary"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"math"
 	"math/big"
 	"math/rand"
-	"os"
 	"runtime"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/TwiN/go-color"
@@ -25,12 +26,16 @@ import (
 	"github.com/spruce-solutions/go-quai/core/types"
 	"github.com/spruce-solutions/go-quai/crypto"
 	"github.com/spruce-solutions/go-quai/ethclient"
+	"github.com/spruce-solutions/go-quai/rpc"
 	"github.com/spruce-solutions/quai-manager/manager/util"
 )
 
 const (
 	// resultQueueSize is the size of channel listening to sealing result.
 	resultQueueSize = 10
+	// offlineRetryInterval is the delay before a mined block that found a chain offline is
+	// submitted again.
+	offlineRetryInterval = 2 * time.Second
 )
 
 var exit = make(chan bool)
@@ -59,47 +64,206 @@ func init() {
 }
 
 type Manager struct {
-	engine *blake3.Blake3
+	engine powEngine
+	config atomic.Value // *util.Config, read with cfg
 
 	orderedBlockClients orderedBlockClients // will hold all chain URLs and settings in order from prime to zone-3-3
 	combinedHeader      *types.Header
 	pendingBlocks       []*types.ReceiptBlock // Current pending blocks of the manager
+	lastPendingKeys     [3]pendingBlockKey    // key of the last pending block enqueued per context
+	pendingTimes        [3]uint64             // time of the last pending header merged per context
+	fetchBackoffs       [3]backoff            // back-off of the pending block fetches per context
 	lock                sync.Mutex
 	location            []byte
 
-	pendingPrimeBlockCh  chan *types.ReceiptBlock
-	pendingRegionBlockCh chan *types.ReceiptBlock
-	pendingZoneBlockCh   chan *types.ReceiptBlock
+	pendingPrimeBlockCh  chan *pendingBlock
+	pendingRegionBlockCh chan *pendingBlock
+	pendingZoneBlockCh   chan *pendingBlock
 
 	updatedCh chan *types.Header
-	resultCh  chan *types.HeaderBundle
-	startCh   chan struct{}
-	exitCh    chan struct{}
-	doneCh    chan bool // channel for updating location
+	resultCh  chan *minedResult
+	submitChs []chan *minedResult // mined headers per context they are submitted for
+
+	submissions     *submissionCancels // cancels the mined block submissions in flight
+	optimizeTimerCh chan int           // OptimizeTimer values reloaded at runtime
+	startCh         chan struct{}
+	exitCh          chan struct{}
+	doneCh          chan struct{}  // closed when the location updates to stop the pending block subscriptions
+	primeDoneCh     chan struct{}  // closed when the prime node is switched to stop the pending block subscription of the old one
+	shutdownCh      chan struct{}  // closed on shutdown to stop the result and submission loops
+	submitLoops     sync.WaitGroup // result and submission loops that are running
+	unqueued        []*minedResult // results the result loop held when it stopped, spooled on shutdown
+
+	workQueue     *workQueue          // optional queue the combined headers are published to for external hashers
+	mineContexts  *contextFlags       // contexts for which mined blocks are submitted, toggled at runtime
+	coinbases     []*coinbaseSelector // weighted coinbase selection per context, nil to keep the node's coinbase
+	extraData     []byte              // extra data the mined headers are tagged with, nil to keep the node's
+	lastSwitch    time.Time           // time the optimizer last selected a location
+	acceptance    *acceptanceTracker  // confirms that submitted blocks become canonical
+	gasUsed       *gasTracker         // recent gas used of the blocks of every chain
+	externalSends *externalSends      // external block sends in flight per target
+
+	externalBatcher *externalBatcher  // batches the external blocks sent to each chain, nil to send them individually
+	miningHeartbeat int64             // unix nanoseconds the mining loop last ran, accessed atomically
+	difficultyWatch *difficultyWatch  // requests an optimizer check when another zone gets easier, nil if disabled
+	fleet           *fleetCoordinator // shares the mined location with the other managers of a fleet, nil when solo
+	reconnecting    int32             // 1 while the reconnect supervisor runs, accessed atomically
+	waitingLogged   [3]int32          // 1 once the wait for the header of a context was logged, accessed atomically
+	seals           sealTracker       // tells interrupted seals from completed ones for the metrics
+	economicPaused  int32             // 1 while the economic gate idles the miner, accessed atomically
+	rewardPerHash   float64           // latest reward per hash estimate of the economic gate
+	nonces          *nonceLog         // logs the nonces of the found seals and warns on reuse
+	minedGaps       *minedGaps        // when the last block of every context was mined
+	archive         *blockArchive     // archives the mined blocks, nil if disabled
+	syncLags        *syncLags         // latest sync lag of every chain, checked if MaxRelaySyncLag is set
+
+	minedSubmissions    *submissionStats // results of mined block submissions per context
+	externalSubmissions *submissionStats // results of external block relays per context
+
+	BlockCache   [][]*lru.Cache // Cache for the most recent entire blocks
+	receiptCache *receiptCache  // Cache for recently fetched block receipts
+}
+
+// minedResult is a header sealed by the miner or a hasher of the work queue, with the bodies of
+// the pending blocks and the location of the work it was sealed from.
+type minedResult struct {
+	*types.HeaderBundle
+	pending  []*types.ReceiptBlock
+	location []byte
+}
+
+// blockClient is the connection to the node of one chain.
+type blockClient struct {
+	url       string            // configured URL of the node
+	client    *ethclient.Client // nil until connected
+	rpc       *rpc.Client       // connection the client uses, for batched calls
+	available bool              // whether the node connected
+
+	pool []*ethclient.Client // additional connections external blocks are relayed through
+	next uint32              // round-robin position in the pool, accessed atomically
+	scan *ethclient.Client   // connection of the optimizer's scan, nil to scan through client
+
+	stats connectionStats // connection history of the node
+}
 
-	BlockCache [][]*lru.Cache // Cache for the most recent entire blocks
+// connect sets the connection of the client to the node.
+func (c *blockClient) connect(client *rpc.Client) {
+	c.rpc = client
+	c.client = ethclient.NewClient(client)
+	c.available = true
+	c.stats.connected(time.Now())
+}
+
+// disconnect marks the node as offline, the connection is kept for the reconnect to replace.
+func (c *blockClient) disconnect() {
+	c.available = false
+	c.stats.disconnected(time.Now())
+}
+
+// redactedURL returns the URL of the node with any credentials redacted, for logs.
+func (c *blockClient) redactedURL() string {
+	return util.RedactURL(c.url)
 }
 
 // Block struct to hold all Client fields.
 type orderedBlockClients struct {
-	primeClient      *ethclient.Client
-	primeAvailable   bool
-	regionClients    []*ethclient.Client
-	regionsAvailable []bool
-	zoneClients      [][]*ethclient.Client
-	zonesAvailable   [][]bool
+	prime   *blockClient
+	regions []*blockClient
+	zones   [][]*blockClient
+}
+
+// at returns the client of the chain at the location, [0, 0] for prime, [region, 0] for a
+// region and [region, zone] for a zone.
+func (c orderedBlockClients) at(location []byte) *blockClient {
+	switch {
+	case location[0] == 0:
+		return c.prime
+	case location[1] == 0:
+		return c.regions[location[0]-1]
+	default:
+		return c.zones[location[0]-1][location[1]-1]
+	}
+}
+
+// url returns the redacted URL of the chain at the location.
+func (c orderedBlockClients) url(location []byte) string {
+	return c.at(location).redactedURL()
+}
+
+// errInvalidLocation is returned for locations that don't name a zone of the clients.
+var errInvalidLocation = errors.New("invalid location")
+
+// checkZone returns an error unless the location is the [region, zone] of one of the zones.
+func (c orderedBlockClients) checkZone(location []byte) error {
+	if len(location) != 2 || location[0] < 1 || int(location[0]) > len(c.zones) || location[1] < 1 || int(location[1]) > len(c.zones[location[0]-1]) {
+		return fmt.Errorf("%w %v", errInvalidLocation, location)
+	}
+	return nil
 }
 
 var exponentialBackoffCeilingSecs int64 = 14400 // 4 hours
 
+// backoffDelaySecs returns the exponential back-off delay in seconds before the given retry,
+// (2^attempts - 1) / 2 rounded down and capped at exponentialBackoffCeilingSecs.
+func backoffDelaySecs(attempts int) int64 {
+	return cappedBackoffDelaySecs(attempts, exponentialBackoffCeilingSecs)
+}
+
+// cappedBackoffDelaySecs is backoffDelaySecs capped at ceiling seconds.
+func cappedBackoffDelaySecs(attempts int, ceiling int64) int64 {
+	delay := math.Floor((math.Pow(2, float64(attempts)) - 1) * 0.5)
+	// clamp as a float, converting +Inf or anything beyond the int64 range is undefined
+	if delay > float64(ceiling) {
+		return ceiling
+	}
+	if delay < 0 {
+		return 0
+	}
+	return int64(delay)
+}
+
 func main() {
-	config, err := util.LoadConfig("..")
+	configPath := flag.String("config", "", "path of the config file (default config/config.yaml)")
+	profile := flag.String("profile", "", "name of the config profile merged on top of the config file")
+	flag.Parse()
+
+	// the benchmark and proof verification are purely local and need neither a config nor nodes
+	if flag.NArg() > 0 && flag.Arg(0) == "bench" {
+		runBench(flag.Args()[1:])
+		return
+	}
+	if flag.NArg() > 0 && flag.Arg(0) == "verify-proof" {
+		runVerifyProof(flag.Args()[1:])
+		return
+	}
+
+	config, err := util.LoadConfig(*configPath, *profile)
 	if err != nil {
 		log.Fatal("cannot load config:", err)
 	}
+	backoffResetWindow = time.Duration(config.BackoffResetWindow) * time.Second
+	// the config as loaded, before the location and mode are resolved, to diff reloads against
+	loadedConfig := config
+
+	args := flag.Args()
+	if len(args) == 2 && args[0] == "config" && args[1] == "dump" {
+		dump, err := config.Dump()
+		if err != nil {
+			log.Fatal("cannot dump config:", err)
+		}
+		fmt.Print(string(dump))
+		return
+	}
+	if len(args) == 1 && args[0] == "worker" {
+		runWorker(config)
+		return
+	}
+	if len(args) > 0 && args[0] == "check-external" {
+		runCheckExternal(config, args[1:])
+		return
+	}
 
-	lastUpdatedAt := time.Now()
-	attempts := 0
+	var connectBackoff backoff
 
 	// errror handling in case any connections failed
 	connectStatus := false
@@ -108,34 +272,30 @@ func main() {
 	allClients := getNodeClients(config)
 
 	for !connectStatus {
-		if time.Now().Sub(lastUpdatedAt).Hours() >= 12 {
-			attempts = 0
-		}
-
 		connectStatus = true
-		if !allClients.primeAvailable {
+		if config.HasPrime && !allClients.prime.available {
 			connectStatus = false
 		}
-		for _, status := range allClients.regionsAvailable {
-			if !status {
+		for _, region := range allClients.regions {
+			if !region.available {
 				connectStatus = false
 			}
 		}
-		for _, zonesArray := range allClients.zonesAvailable {
-			for _, status := range zonesArray {
-				if !status {
+		for _, zonesArray := range allClients.zones {
+			for _, zone := range zonesArray {
+				if !zone.available {
 					connectStatus = false
 				}
 			}
 		}
-		lastUpdatedAt = time.Now()
-		attempts += 1
+		if !connectStatus && !config.RequireAllChains && sliceOnline(allClients.states(), requiredSlice(config, args), config.HasPrime) {
+			log.Println("Mining slice online, connecting the other chains in the background")
+			break
+		}
+		attempts := connectBackoff.Fail()
 
 		// exponential back-off implemented
-		delaySecs := int64(math.Floor((math.Pow(2, float64(attempts)) - 1) * 0.5))
-		if delaySecs > exponentialBackoffCeilingSecs {
-			delaySecs = exponentialBackoffCeilingSecs
-		}
+		delaySecs := backoffDelaySecs(attempts)
 
 		// should only get here if the ffmpeg record stream process dies
 		fmt.Printf("This is attempt %d to connect to all go-quai nodes. Waiting %d seconds and then retrying...\n", attempts, delaySecs)
@@ -145,6 +305,12 @@ func main() {
 		allClients = getNodeClients(config)
 	}
 
+	if config.VerifyNodeIdentities {
+		if err := verifyNodeIdentities(allClients); err != nil {
+			log.Fatal("Node does not match its configured location: ", err)
+		}
+	}
+
 	if !connectStatus {
 		log.Println("Some or all connections to chains not available")
 		log.Println("For best performance check your connections and restart the manager")
@@ -152,14 +318,26 @@ func main() {
 
 	// variable to check whether mining location is set manually or automatically
 	var changeLocationCycle bool
+	// time the optimizer last selected a location
+	var lastSwitch time.Time
+	// whether the auto-miner starts at InitialLocation and scans once mining started
+	var warmStart bool
+
+	var fleet *fleetCoordinator
+	if config.CoordinationURL != "" {
+		fleet, err = newFleetCoordinator(config.CoordinationURL, config.CoordinationKey, config.CoordinationID, time.Duration(config.CoordinationTTL)*time.Second)
+		if err != nil {
+			log.Fatal("Failed to create fleet coordinator: ", err)
+		}
+	}
 
 	// set mining location
 	// if using the run-mine command then must remember to set region and zone locations
 	// if using run then the manager will automatically follow the chain with lowest difficulty
-	if len(os.Args) > 3 {
+	if len(args) > 2 {
 		changeLocationCycle = false
-		location := os.Args[1:3]
-		mine, _ := strconv.Atoi(os.Args[3:][0])
+		location := args[0:2]
+		mine, _ := strconv.Atoi(args[2])
 
 		// error management to check correct number of values provided
 		if len(location) == 0 {
@@ -187,7 +365,26 @@ func main() {
 		log.Println(color.Ize(color.Red, "Manual mode started"))
 	} else {
 		if config.Auto && config.Mine { // auto-miner
-			config.Location = findBestLocation(allClients)
+			// resume from the last location the optimizer selected if it is still allowed
+			if state := resumableOptimizerState(config); state != nil {
+				config.Location = state.location()
+				lastSwitch = state.LastSwitch
+				log.Println("Resuming optimizer at persisted location", "location", config.Location, "lastSwitch", lastSwitch)
+			} else if initial := initialLocation(config, allClients); initial != nil {
+				// mine right away, the first scan runs once mining started
+				config.Location = initial
+				fleet.register(config.Location)
+				warmStart = true
+				log.Println("Starting at initial location, the first scan runs in the background", "location", config.Location)
+			} else {
+				config.Location, err = findBestLocation(allClients.states(), fleet.withPeers(newOptimizerOptions(config)))
+				if err != nil {
+					log.Fatal("Failed to find a location to mine: ", err)
+				}
+				fleet.register(config.Location)
+				lastSwitch = time.Now()
+				persistOptimizerState(config.OptimizerStateFile, config.Location, lastSwitch)
+			}
 			config.Mine = true
 			changeLocationCycle = config.Optimize
 			fmt.Println("Aut-miner mode started with Optimizer= ", config.Optimize, "and timer set to ", config.OptimizeTimer, "minutes")
@@ -231,46 +428,181 @@ func main() {
 		log.Fatal("Failed to create Blake3 engine: ", err)
 	}
 
+	coinbases, err := newCoinbaseSelectors(config.Coinbases)
+	if err != nil {
+		log.Fatal("Invalid coinbase config: ", err)
+	}
+
+	extraData, err := parseExtraData(config.ExtraData)
+	if err != nil {
+		log.Fatal("Invalid extra data config: ", err)
+	}
+
+	receiptCache, err := newReceiptCache(config.ReceiptCacheSize, time.Duration(config.ReceiptCacheTTL)*time.Second, newMemoryBudget(config.CacheMemoryBudget))
+	if err != nil {
+		log.Fatal("Failed to create receipt cache: ", err)
+	}
+
+	if err := checkChainOverrides(config.ChainOverrides, allClients); err != nil {
+		log.Fatal("Invalid chain overrides: ", err)
+	}
+
 	m := &Manager{
 		engine:               blake3Engine,
 		orderedBlockClients:  allClients,
 		combinedHeader:       header,
 		pendingBlocks:        make([]*types.ReceiptBlock, 3),
-		pendingPrimeBlockCh:  make(chan *types.ReceiptBlock, resultQueueSize),
-		pendingRegionBlockCh: make(chan *types.ReceiptBlock, resultQueueSize),
-		pendingZoneBlockCh:   make(chan *types.ReceiptBlock, resultQueueSize),
-		resultCh:             make(chan *types.HeaderBundle, resultQueueSize),
+		pendingPrimeBlockCh:  make(chan *pendingBlock, resultQueueSize),
+		pendingRegionBlockCh: make(chan *pendingBlock, resultQueueSize),
+		pendingZoneBlockCh:   make(chan *pendingBlock, resultQueueSize),
+		resultCh:             make(chan *minedResult, resultQueueSize),
+		submitChs:            newSubmitChannels(),
+		submissions:          newSubmissionCancels(),
+		optimizeTimerCh:      make(chan int, 1),
 		updatedCh:            make(chan *types.Header, resultQueueSize),
 		exitCh:               make(chan struct{}),
+		shutdownCh:           make(chan struct{}),
 		startCh:              make(chan struct{}, 1),
-		doneCh:               make(chan bool),
 		location:             config.Location,
+		receiptCache:         receiptCache,
+		mineContexts:         newContextFlags(config.MineContexts.Prime, config.MineContexts.Region, config.MineContexts.Zone),
+		coinbases:            coinbases,
+		extraData:            extraData,
+		lastSwitch:           lastSwitch,
+		acceptance:           newAcceptanceTracker(config.AcceptanceDepth, config.AlertWebhook),
+		gasUsed:              newGasTracker(),
+		difficultyWatch:      newDifficultyWatch(config.OptimizerDifficultyDrop),
+		fleet:                fleet,
+		externalSends:        newExternalSends(time.Duration(config.MissingExternalDedupWindow) * time.Millisecond),
+		minedSubmissions:     newSubmissionStats(),
+		externalSubmissions:  newSubmissionStats(),
+		minedGaps:            newMinedGaps(),
+		syncLags:             newSyncLags(),
+	}
+	m.config.Store(&config)
+
+	m.nonces, err = newNonceLog(time.Duration(config.NonceReuseWindow)*time.Second, config.NonceLogFile)
+	if err != nil {
+		log.Fatal("Failed to open nonce log: ", err)
+	}
+
+	if config.AcceptanceDepth > 0 {
+		safeGo("acceptance", func() { m.acceptance.loop() })
+	}
+
+	if config.ArchiveDir != "" || config.ArchiveURL != "" {
+		m.archive = newBlockArchive(config.ArchiveDir, config.ArchiveURL, config.ArchiveQueueSize)
+		safeGo("archive", func() { m.archive.loop() })
+	}
+
+	if config.ExternalBatchWindow > 0 {
+		m.externalBatcher, err = newExternalBatcher(time.Duration(config.ExternalBatchWindow)*time.Millisecond, config.ExternalBatchSize)
+		if err != nil {
+			log.Fatal("Failed to create external block batcher: ", err)
+		}
 	}
 
-	go m.subscribeNewHead()
+	if config.WorkQueueURL != "" {
+		m.workQueue, err = newWorkQueue(config.WorkQueueURL, config.WorkQueueChannel, config.SolutionQueueChannel)
+		if err != nil {
+			log.Fatal("Failed to create work queue: ", err)
+		}
+	}
 
-	go m.subscribeMissingExternalBlock()
+	if !connectStatus {
+		m.startReconnect()
+	}
+
+	m.subscribeNewHead()
+
+	m.subscribeMissingExternalBlock()
+
+	if config.HasPrime && len(config.PrimeBackupURLs) > 0 {
+		safeGo("failoverPrime", func() { m.failoverPrime() })
+	}
+
+	if config.HTTPAddr != "" {
+		safeGo("serveHTTP", func() { m.serveHTTP(config.HTTPAddr) })
+	}
+
+	if m.fleet != nil && config.Mine {
+		safeGo("keepFleetRegistration", func() { m.keepFleetRegistration() })
+	}
+
+	if config.MaxRelaySyncLag > 0 {
+		safeGo("watchSyncLags", func() { m.watchSyncLags() })
+	}
+
+	safeGo("updateConnectionMetrics", func() { m.updateConnectionMetrics() })
+
+	if config.ReceiptCacheSize > 0 {
+		safeGo("logCacheStats", func() { m.logCacheStats() })
+	}
+
+	// started even if disabled, so that a reload can enable the queue diagnostics
+	safeGo("logQueueDepths", m.logQueueDepths)
+
+	safeGo("reloadOnHangup", func() { m.reloadOnHangup(*configPath, *profile, loadedConfig) })
+
+	if config.SystemdNotify {
+		safeGo("systemdNotify", func() { m.systemdNotify() })
+	}
 
 	if config.Mine {
 		log.Println("Starting manager in location ", config.Location)
 
+		m.waitForSliceSync()
+
+		// compare to synced heads, blocks of nodes still syncing look like a clock ahead
+		verifyClock(m.chainStates(), config.MaxClockSkew, config.RefuseClockSkew)
+
+		// subscribe first so that no update is missed, but merge the initial pending blocks
+		// before any update and before the miner starts so that it begins on a complete header
 		m.subscribeAllPendingBlocks()
 
-		go m.resultLoop()
+		m.mergeInitialPendingBlocks()
+
+		safeGo("resultLoop", func() { m.resultLoop() })
+
+		if config.SpoolDir != "" {
+			safeGo("spoolOnShutdown", func() { m.spoolOnShutdown() })
+			safeGo("replaySpool", func() { m.replaySpool() })
+		}
+
+		safeGo("miningLoop", func() { m.miningLoop() })
+
+		if config.MinRewardPerHash > 0 {
+			safeGo("economicGate", func() { m.economicGate() })
+		}
+
+		if config.MinedGapAlert > 0 {
+			safeGo("watchMinedGaps", func() { m.watchMinedGaps() })
+		}
 
-		go m.miningLoop()
+		m.SubmitHashRate()
 
-		go m.SubmitHashRate()
+		safeGo("loopGlobalBlock", func() { m.loopGlobalBlock() })
 
-		go m.loopGlobalBlock()
+		if m.workQueue != nil {
+			safeGo("subscribeSolutions", m.subscribeSolutions)
+			safeGo("publishLoop", m.publishLoop)
+		}
 
-		// fetching the pending blocks
-		m.fetchAllPendingBlocks()
+		if config.Dashboard {
+			safeGo("dashboard", m.dashboard)
+		}
 
 		if changeLocationCycle {
-			go m.checkBestLocation(config.OptimizeTimer)
+			m.checkBestLocation(config.OptimizeTimer, warmStart)
+		} else if warmStart {
+			safeGo("warmStartScan", m.warmStartScan)
+		} else if len(config.FailoverLocations) > 0 {
+			primary := append([]byte{}, config.Location...)
+			safeGo("failover", func() { m.failover(primary) })
 		}
 	}
+
+	m.logStartupSummary(startupMode(config, args), changeLocationCycle, blake3Config.MiningThreads)
 	<-exit
 }
 
@@ -278,60 +610,73 @@ func main() {
 // that is used for mining in a slice.
 func getNodeClients(config util.Config) orderedBlockClients {
 
-	// initializing all the clients
 	allClients := orderedBlockClients{
-		primeAvailable:   false,
-		regionClients:    make([]*ethclient.Client, 3),
-		regionsAvailable: make([]bool, 3),
-		zoneClients:      make([][]*ethclient.Client, 3),
-		zonesAvailable:   make([][]bool, 3),
+		prime: &blockClient{url: config.PrimeURL},
 	}
 
-	for i := range allClients.zoneClients {
-		allClients.zoneClients[i] = make([]*ethclient.Client, 3)
-	}
-	for i := range allClients.zonesAvailable {
-		allClients.zonesAvailable[i] = make([]bool, 3)
+	// add Prime to orderedBlockClient array at [0]
+	if config.HasPrime && allClients.prime.url != "" {
+		options := newDialOptions(config, []byte{0, 0})
+		url, primeClient, err := dialPrime(primeURLs(config), options)
+		if err == nil {
+			allClients.prime.url = url
+			allClients.prime.connect(primeClient)
+			allClients.prime.pool = dialPool(url, config.RelayPoolSizes.Prime, options)
+		}
 	}
 
-	// add Prime to orderedBlockClient array at [0]
-	if config.PrimeURL != "" {
-		primeClient, err := ethclient.Dial(config.PrimeURL)
-		if err != nil {
-			log.Println("Unable to connect to node:", "Prime", config.PrimeURL)
-		} else {
-			allClients.primeClient = primeClient
-			allClients.primeAvailable = true
+	// size the region and zone clients to the slice dimensions of the network, which prime
+	// knows, rather than to the configured URLs
+	numRegions, numZones := discoverOntology(allClients.prime)
+	allClients.regions = make([]*blockClient, numRegions)
+	allClients.zones = make([][]*blockClient, numRegions)
+	for i := range allClients.regions {
+		allClients.regions[i] = &blockClient{}
+		if i < len(config.RegionURLs) {
+			allClients.regions[i].url = config.RegionURLs[i]
+		}
+	}
+	for i := range allClients.zones {
+		allClients.zones[i] = make([]*blockClient, numZones)
+		for j := range allClients.zones[i] {
+			allClients.zones[i][j] = &blockClient{}
+			if i < len(config.ZoneURLs) && j < len(config.ZoneURLs[i]) {
+				allClients.zones[i][j].url = config.ZoneURLs[i][j]
+			}
 		}
 	}
 
 	// loop to add Regions to orderedBlockClient
 	// remember to set true value for Region to be mined
-	for i, regionURL := range config.RegionURLs {
-		if regionURL != "" {
-			regionClient, err := ethclient.Dial(regionURL)
+	for i, region := range allClients.regions {
+		if region.url != "" {
+			options := newDialOptions(config, []byte{byte(i + 1), 0})
+			regionClient, err := dialNode(region.url, options)
 			if err != nil {
-				log.Println("Unable to connect to node:", "Region", i+1, regionURL)
-				allClients.regionsAvailable[i] = false
+				log.Println("Unable to connect to node:", "Region", i+1, region.redactedURL())
+				region.available = false
 			} else {
-				allClients.regionsAvailable[i] = true
-				allClients.regionClients[i] = regionClient
+				region.connect(regionClient)
+				region.pool = dialPool(region.url, config.RelayPoolSizes.Region, options)
+				region.scan = dialScan(region.url, config.OptimizerConnection, options)
 			}
 		}
 	}
 
 	// loop to add Zones to orderedBlockClient
 	// remember ZoneURLS is a 2D array
-	for i, zonesURLs := range config.ZoneURLs {
-		for j, zoneURL := range zonesURLs {
-			if zoneURL != "" {
-				zoneClient, err := ethclient.Dial(zoneURL)
+	for i, zones := range allClients.zones {
+		for j, zone := range zones {
+			if zone.url != "" {
+				options := newDialOptions(config, []byte{byte(i + 1), byte(j + 1)})
+				zoneClient, err := dialNode(zone.url, options)
 				if err != nil {
-					log.Println("Unable to connect to node:", "Zone", i+1, j+1, zoneURL)
-					allClients.zonesAvailable[i][j] = false
+					log.Println("Unable to connect to node:", "Zone", i+1, j+1, zone.redactedURL())
+					zone.available = false
 				} else {
-					allClients.zonesAvailable[i][j] = true
-					allClients.zoneClients[i][j] = zoneClient
+					zone.connect(zoneClient)
+					zone.pool = dialPool(zone.url, config.RelayPoolSizes.Zone, options)
+					zone.scan = dialScan(zone.url, config.OptimizerConnection, options)
 				}
 			}
 		}
@@ -341,38 +686,25 @@ func getNodeClients(config util.Config) orderedBlockClients {
 
 // subscribePendingHeader subscribes to the head of the mining nodes in order to pass
 // the most up to date block to the miner within the manager.
-func (m *Manager) subscribePendingHeader(client *ethclient.Client, sliceIndex int) {
+func (m *Manager) subscribePendingHeader(client *ethclient.Client, sliceIndex int, done <-chan struct{}) {
 	log.Println("Current location is ", m.location)
-	// check the status of the sync
-	checkSync, err := client.SyncProgress(context.Background())
-
-	if err != nil {
-		switch sliceIndex {
-		case 0:
-			log.Println("Error occured while synching to Prime")
-		case 1:
-			log.Println("Error occured while synching to Region")
-		case 2:
-			log.Println("Error occured while synching to Zone")
-		}
-	}
-
-	// wait until sync is nil to continue
-	for checkSync != nil && err == nil {
-		checkSync, err = client.SyncProgress(context.Background())
-		if err != nil {
-			log.Println("error during syncing: ", err, checkSync)
-		}
-	}
+	// wait until the node is synced to continue
+	err := waitForSync(client, sliceIndex, m.syncPollInterval(sliceIndex), m.cfg().SyncSettleDelay.Duration(sliceIndex))
 
 	// done channel in case best Location updates
 	// subscribe to the pending block only if not synching
-	if checkSync == nil && err == nil {
+	if err == nil {
 		// Wait for chain events and push them to clients
 		header := make(chan *types.Header)
 		sub, err := client.SubscribePendingBlock(context.Background(), header)
 		if err != nil {
-			log.Fatal("Failed to subscribe to pending block events", err)
+			interval := time.Duration(m.cfg().PendingPollInterval) * time.Millisecond
+			if interval <= 0 {
+				log.Fatal("Failed to subscribe to pending block events", err)
+			}
+			log.Println("Pending block subscription not supported, polling instead", "context", contextNames[sliceIndex], "interval", interval, "err", err)
+			m.pollPendingBlocks(client, sliceIndex, interval, done)
+			return
 		}
 		defer sub.Unsubscribe()
 
@@ -382,22 +714,56 @@ func (m *Manager) subscribePendingHeader(client *ethclient.Client, sliceIndex in
 			case <-header:
 				// New head arrived, send if for state update if there's none running
 				m.fetchPendingBlocks(client, sliceIndex)
-			case <-m.doneCh: // location updated and this routine needs to be stopped to start a new one
-				break
+			case <-done: // location updated and this routine needs to be stopped to start a new one
+				return
 			}
 		}
 	}
 }
 
+// pollPendingBlocks fetches the pending block of the context every interval for nodes that
+// don't support pending block subscriptions. Only blocks whose template changed since the last
+// poll are merged.
+func (m *Manager) pollPendingBlocks(client *ethclient.Client, sliceIndex int, interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last pendingBlockKey
+	for {
+		select {
+		case <-ticker.C:
+			pending := m.fetchPendingBlock(client, sliceIndex)
+			if pending == nil {
+				continue
+			}
+			if key := pending.key(sliceIndex); key != last {
+				last = key
+				m.enqueuePendingBlock(pending, sliceIndex)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
 // subscribeNewHead passes new head blocks as external blocks to lower level chains.
 func (m *Manager) subscribeNewHead() {
 	// subscribe to the prime client at context 0
-	go m.subscribeNewHeadClient(m.orderedBlockClients.primeClient, 0)
+	if m.cfg().HasPrime {
+		primeClient := m.orderedBlockClients.prime.client
+		safeGo("subscribeNewHeadClient prime", func() { m.subscribeNewHeadClient(primeClient, 0) })
+	}
 	// subscribe to the region clients
-	for i, blockClient := range m.orderedBlockClients.regionClients {
-		go m.subscribeNewHeadClient(blockClient, 1)
-		for _, zoneBlockClient := range m.orderedBlockClients.zoneClients[i] {
-			go m.subscribeNewHeadClient(zoneBlockClient, 2)
+	for i, region := range m.orderedBlockClients.regions {
+		regionClient := region.client
+		if regionClient != nil {
+			safeGo(fmt.Sprint("subscribeNewHeadClient region ", i+1), func() { m.subscribeNewHeadClient(regionClient, 1) })
+		}
+		for j, zone := range m.orderedBlockClients.zones[i] {
+			zoneClient := zone.client
+			if zoneClient == nil {
+				continue
+			}
+			safeGo(fmt.Sprint("subscribeNewHeadClient zone ", i+1, "-", j+1), func() { m.subscribeNewHeadClient(zoneClient, 2) })
 		}
 	}
 }
@@ -413,7 +779,18 @@ func (m *Manager) subscribeNewHeadClient(client *ethclient.Client, difficultyCon
 	for {
 		select {
 		case newHead := <-newHeadChannel:
+			// relaying only needs the newest head, those that arrived meanwhile are skipped
+			if m.cfg().CoalesceNewHeads {
+				newHead = latestHead(newHeadChannel, newHead, difficultyContext)
+			}
 			// log.Println("New Head Event:", "location", newHead.Location, "context", difficultyContext, "number", newHead.Number, "hash", newHead.Hash())
+			m.acceptance.CheckHead(client, difficultyContext, newHead)
+			if len(newHead.GasUsed) > difficultyContext {
+				m.gasUsed.Observe(chainLocation(newHead.Location, difficultyContext), newHead.GasUsed[difficultyContext])
+			}
+			if difficultyContext == 2 && len(newHead.Difficulty) > 2 {
+				m.difficultyWatch.Observe(chainLocation(newHead.Location, 2), newHead.Difficulty[2], chainLocation(m.currentLocation(), 2))
+			}
 
 			// get the block and receipt block
 			block, err := client.BlockByHash(context.Background(), newHead.Hash())
@@ -422,7 +799,7 @@ func (m *Manager) subscribeNewHeadClient(client *ethclient.Client, difficultyCon
 				continue
 			}
 
-			receiptBlock, receiptErr := client.GetBlockReceipts(context.Background(), newHead.Hash())
+			receiptBlock, receiptErr := m.blockReceipts(client, block, difficultyContext)
 			if receiptErr != nil {
 				log.Println("Failed to retrieve receipts for new head", "hash", newHead.Hash(), "err", receiptErr)
 				continue
@@ -433,59 +810,121 @@ func (m *Manager) subscribeNewHeadClient(client *ethclient.Client, difficultyCon
 
 			if difficultyContext == 0 {
 				// get the externalBlock for region and zone
-				regionExternalBlock, err := m.orderedBlockClients.primeClient.GetExternalBlockByHashAndContext(context.Background(), block.Header().Hash(), 1)
+				regionExternalBlock, err := m.getExternalBlock(block.Header().Hash(), 1, block.Header().Location)
 				if regionExternalBlock == nil {
 					log.Println("regionExternalBlock is nil for difficulty context 0", "hash", newHead.Hash(), "err", err)
-					break
+					continue
 				}
-				regionBlock := types.NewBlockWithHeader(regionExternalBlock.Header()).WithBody(regionExternalBlock.Transactions(), regionExternalBlock.Uncles())
-
 				// seal the region block
-				sealed := regionBlock.WithSeal(regionBlock.Header())
-				m.orderedBlockClients.regionClients[int(regionBlock.Header().Location[0])-1].SendMinedBlock(context.Background(), sealed, true, true)
+				m.sendSealedBlock(regionExternalBlock, 1)
 
-				zoneExternalBlock, err := m.orderedBlockClients.primeClient.GetExternalBlockByHashAndContext(context.Background(), block.Header().Hash(), 2)
+				zoneExternalBlock, err := m.getExternalBlock(block.Header().Hash(), 2, block.Header().Location)
 				if zoneExternalBlock == nil {
 					log.Println("zoneExternalBlock is nil for difficulty context 0", "hash", newHead.Hash(), "err", err)
-					break
+					continue
 				}
-				zoneBlock := types.NewBlockWithHeader(zoneExternalBlock.Header()).WithBody(zoneExternalBlock.Transactions(), zoneExternalBlock.Uncles())
 				// seal the zone block
-				sealed = zoneBlock.WithSeal(zoneBlock.Header())
-				m.orderedBlockClients.zoneClients[int(zoneBlock.Header().Location[0])-1][int(zoneBlock.Header().Location[1])-1].SendMinedBlock(context.Background(), sealed, true, true)
+				m.sendSealedBlock(zoneExternalBlock, 2)
 
-				m.SendClientsExtBlock(difficultyContext, []int{1, 2}, block, receiptBlock)
+				m.SendClientsExtBlock(context.Background(), difficultyContext, []int{1, 2}, block, receiptBlock)
 			} else if difficultyContext == 1 {
-				zoneExternalBlock, err := m.orderedBlockClients.regionClients[int(block.Header().Location[0])-1].GetExternalBlockByHashAndContext(context.Background(), block.Header().Hash(), 2)
+				region := m.availableChain(chainLocation(block.Header().Location, 1))
+				if region == nil {
+					log.Println("Region of the new head not available for difficulty context 1", "hash", newHead.Hash(), "location", block.Header().Location)
+					continue
+				}
+				zoneExternalBlock, err := region.GetExternalBlockByHashAndContext(context.Background(), block.Header().Hash(), 2)
 				if zoneExternalBlock == nil {
 					log.Println("zoneExternalBlock is nil for difficulty context 1", "hash", newHead.Hash(), "err", err)
-					break
+					continue
 				}
-				zoneBlock := types.NewBlockWithHeader(zoneExternalBlock.Header()).WithBody(zoneExternalBlock.Transactions(), zoneExternalBlock.Uncles())
 
 				// seal the zone block
-				sealed := zoneBlock.WithSeal(zoneBlock.Header())
-				m.orderedBlockClients.zoneClients[int(zoneBlock.Header().Location[0])-1][int(zoneBlock.Header().Location[1])-1].SendMinedBlock(context.Background(), sealed, true, true)
+				m.sendSealedBlock(zoneExternalBlock, 2)
 
-				m.SendClientsExtBlock(difficultyContext, []int{0, 2}, block, receiptBlock)
+				m.SendClientsExtBlock(context.Background(), difficultyContext, []int{0, 2}, block, receiptBlock)
 			} else if difficultyContext == 2 {
-				m.SendClientsExtBlock(difficultyContext, []int{0, 1}, block, receiptBlock)
+				m.SendClientsExtBlock(context.Background(), difficultyContext, []int{0, 1}, block, receiptBlock)
 			}
 		}
 	}
 }
 
+// getExternalBlock looks up the external block for the given hash and context in the prime chain
+// and falls back to the region chain of the given location if prime doesn't have it.
+func (m *Manager) getExternalBlock(hash common.Hash, difficultyContext int, location []byte) (*types.ExternalBlock, error) {
+	var externalBlock *types.ExternalBlock
+	var err error
+	if prime := m.availableChain([2]byte{}); m.cfg().HasPrime && prime != nil {
+		externalBlock, err = prime.GetExternalBlockByHashAndContext(context.Background(), hash, difficultyContext)
+	}
+	if externalBlock != nil || len(location) == 0 {
+		return externalBlock, err
+	}
+	region := m.availableChain(chainLocation(location, 1))
+	if region == nil {
+		return nil, fmt.Errorf("region of location %v not available", location)
+	}
+	return region.GetExternalBlockByHashAndContext(context.Background(), hash, difficultyContext)
+}
+
+// availableChain returns the client of the chain at the location if it is configured and
+// connected, nil otherwise.
+func (m *Manager) availableChain(location [2]byte) *ethclient.Client {
+	clients := m.orderedBlockClients
+	switch {
+	case location[0] == 0:
+	case int(location[0]) > len(clients.regions):
+		return nil
+	case location[1] != 0 && (int(location[0]) > len(clients.zones) || int(location[1]) > len(clients.zones[location[0]-1])):
+		return nil
+	}
+	chain := m.chainState(clients.at(location[:]))
+	if !chain.available {
+		return nil
+	}
+	return chain.client
+}
+
+// sendSealedBlock sends the external block of the context to its chain as a mined block. The
+// block is dropped if its chain isn't available.
+func (m *Manager) sendSealedBlock(externalBlock *types.ExternalBlock, difficultyContext int) {
+	header := externalBlock.Header()
+	target := chainLocation(header.Location, difficultyContext)
+	chain := m.availableChain(target)
+	if chain == nil {
+		log.Println("Not sending sealed block to an unavailable chain", "target", target[:], "context", contextNames[difficultyContext], "hash", header.Hash())
+		return
+	}
+	block := types.NewBlockWithHeader(header).WithBody(externalBlock.Transactions(), externalBlock.Uncles())
+	sealed := block.WithSeal(block.Header())
+	inclTx, fullTx := m.minedBlockEncoding(difficultyContext)
+	err := chain.SendMinedBlock(context.Background(), sealed, inclTx, fullTx)
+	m.logSend("sealed block", target[:], sealed.Hash(), difficultyContext, err)
+}
+
 func (m *Manager) subscribeMissingExternalBlock() {
 	// prime client
-	go m.subscribeMissingExternalBlockClient(m.orderedBlockClients.primeClient, []byte{0, 0})
+	if m.cfg().HasPrime {
+		primeClient := m.orderedBlockClients.prime.client
+		safeGo("subscribeMissingExternalBlockClient prime", func() { m.subscribeMissingExternalBlockClient(primeClient, []byte{0, 0}) })
+	}
 	// region clients
-	for i, regionClient := range m.orderedBlockClients.regionClients {
-		go m.subscribeMissingExternalBlockClient(regionClient, []byte{uint8(i + 1), 0})
+	for i, region := range m.orderedBlockClients.regions {
+		if region.client == nil {
+			continue
+		}
+		client, chain := region.client, []byte{uint8(i + 1), 0}
+		safeGo(fmt.Sprint("subscribeMissingExternalBlockClient region ", chain), func() { m.subscribeMissingExternalBlockClient(client, chain) })
 	}
 	// zone clients
-	for i, zoneClients := range m.orderedBlockClients.zoneClients {
-		for j, zoneClient := range zoneClients {
-			go m.subscribeMissingExternalBlockClient(zoneClient, []byte{uint8(i + 1), uint8(j + 1)})
+	for i, zoneClients := range m.orderedBlockClients.zones {
+		for j, zone := range zoneClients {
+			if zone.client == nil {
+				continue
+			}
+			client, chain := zone.client, []byte{uint8(i + 1), uint8(j + 1)}
+			safeGo(fmt.Sprint("subscribeMissingExternalBlockClient zone ", chain), func() { m.subscribeMissingExternalBlockClient(client, chain) })
 		}
 	}
 }
@@ -520,29 +959,30 @@ func (m *Manager) subscribeMissingExternalBlockClient(client *ethclient.Client,
 	for {
 		select {
 		case missingExternalBlock := <-missingExternalBlockCh:
-			var client *ethclient.Client
-			var cxt *big.Int
+			// catching up nodes repeat their requests, answer each once within the window
+			if m.externalSends.recentlySent(newExternalSendKey(chain, missingExternalBlock.Hash, missingExternalBlock.Context)) {
+				continue
+			}
+			var source *blockClient
 			// prime
 			if missingExternalBlock.Context == 0 {
-				client = m.orderedBlockClients.primeClient
-				cxt = big.NewInt(0)
+				source = m.orderedBlockClients.prime
 			}
 			// regions
 			if missingExternalBlock.Context == 1 {
-				client = m.orderedBlockClients.regionClients[int(missingExternalBlock.Location[0])-1]
-				cxt = big.NewInt(1)
+				source = m.orderedBlockClients.regions[int(missingExternalBlock.Location[0])-1]
 			}
 			// zones
 			if missingExternalBlock.Context == 2 {
-				client = m.orderedBlockClients.zoneClients[int(missingExternalBlock.Location[0])-1][int(missingExternalBlock.Location[1])-1]
-				cxt = big.NewInt(2)
+				source = m.orderedBlockClients.zones[int(missingExternalBlock.Location[0])-1][int(missingExternalBlock.Location[1])-1]
 			}
+			client := m.chainState(source).client
 			block, _ := client.BlockByHash(context.Background(), missingExternalBlock.Hash)
 
 			var receipts []*types.Receipt
 			// if we find the block
 			if block != nil {
-				receiptBlock, err := client.GetBlockReceipts(context.Background(), missingExternalBlock.Hash)
+				receiptBlock, err := m.blockReceipts(client, block, missingExternalBlock.Context)
 				if receiptBlock == nil {
 					log.Println("Failed to get receiptBlock in missing external block")
 				}
@@ -553,21 +993,19 @@ func (m *Manager) subscribeMissingExternalBlockClient(client *ethclient.Client,
 				receipts = receiptBlock.Receipts()
 				// if we don't find the block we have to reconstruct the block from the external block from a dominant chain
 			} else {
-				// check the prime to see if the external block for the given context exists
-				externalBlock, _ := m.orderedBlockClients.primeClient.GetExternalBlockByHashAndContext(context.Background(), missingExternalBlock.Hash, missingExternalBlock.Context)
-				// if we find the external block in prime, we stop or else we continue to look at the region
-				if externalBlock != nil {
-					block = types.NewBlockWithHeader(externalBlock.Header()).WithBody(externalBlock.Transactions(), externalBlock.Uncles())
-					receipts = externalBlock.Body().Receipts
-				} else {
-					// check the corresponding region chain to see if the external block for the given context exists
-					externalBlock, err = m.orderedBlockClients.regionClients[int(missingExternalBlock.Location[0])-1].GetExternalBlockByHashAndContext(context.Background(), missingExternalBlock.Hash, missingExternalBlock.Context)
-					// if we find the external block in the region we stop or there is currently no way to get the missing external block
-					if externalBlock != nil {
-						block = types.NewBlockWithHeader(externalBlock.Header()).WithBody(externalBlock.Transactions(), externalBlock.Uncles())
-						receipts = externalBlock.Body().Receipts
-					} else {
-						log.Println("Error getting external block", "location", missingExternalBlock.Location, "context", missingExternalBlock.Context, "hash", missingExternalBlock.Hash, "err", err)
+				// check the prime and then the corresponding region chain to see if the external block for the given context exists
+				externalBlock, err := m.getExternalBlock(missingExternalBlock.Hash, missingExternalBlock.Context, missingExternalBlock.Location)
+				// if we don't find the external block there is currently no way to get the missing external block
+				if externalBlock == nil {
+					log.Println("Error getting external block", "location", missingExternalBlock.Location, "context", missingExternalBlock.Context, "hash", missingExternalBlock.Hash, "err", err)
+					continue
+				}
+				block = types.NewBlockWithHeader(externalBlock.Header()).WithBody(externalBlock.Transactions(), externalBlock.Uncles())
+				receipts = externalBlock.Body().Receipts
+				if m.cfg().VerifyExternalReceipts {
+					if err := checkReceipts(block, receipts, missingExternalBlock.Context); err != nil {
+						receiptMismatchCounter.Inc(1)
+						log.Println("Skipping missing external block with inconsistent receipts", "location", missingExternalBlock.Location, "context", missingExternalBlock.Context, "hash", missingExternalBlock.Hash, "err", err)
 						continue
 					}
 				}
@@ -578,19 +1016,13 @@ func (m *Manager) subscribeMissingExternalBlockClient(client *ethclient.Client,
 			}
 
 			// sending the external Block back to the client
-			var extClient *ethclient.Client
-			if int(chain[0]) == 0 && int(chain[1]) == 0 {
-				extClient = m.orderedBlockClients.primeClient
-			} else if int(chain[0]) != 0 && int(chain[1]) == 0 {
-				extClient = m.orderedBlockClients.regionClients[chain[0]-1]
-			} else {
-				extClient = m.orderedBlockClients.zoneClients[chain[0]-1][chain[1]-1]
-			}
+			extClient := m.chainState(m.orderedBlockClients.at(chain)).client
 
-			if err := extClient.SendExternalBlock(context.Background(), block, receipts, cxt); err != nil {
-				log.Println("Failed to send external block to chain in ", missingExternalBlock.Location, err)
-				continue
-			}
+			err := m.externalSends.do(newExternalSendKey(chain, block.Hash(), missingExternalBlock.Context), func() error {
+				return m.postExternalBlock(context.Background(), chain, extClient, block, receipts, missingExternalBlock.Context)
+			})
+			incChainCounter(missingExternalCounters, chain)
+			m.logSend("missing external block", chain, block.Hash(), missingExternalBlock.Context, err)
 		}
 	}
 }
@@ -598,83 +1030,190 @@ func (m *Manager) subscribeMissingExternalBlockClient(client *ethclient.Client,
 // PendingBlocks gets the latest block when we have received a new pending header. This will get the receipts,
 // transactions, and uncles to be stored during mining.
 func (m *Manager) fetchPendingBlocks(client *ethclient.Client, sliceIndex int) {
-	var receiptBlock *types.ReceiptBlock
-	var err error
+	if pending := m.fetchPendingBlock(client, sliceIndex); pending != nil {
+		m.enqueuePendingBlock(pending, sliceIndex)
+	}
+}
 
-	m.lock.Lock()
-	receiptBlock, err = client.GetPendingBlock(context.Background())
+// enqueuePendingBlock hands the pending block of the context to loopGlobalBlock to be merged.
+func (m *Manager) enqueuePendingBlock(pending *pendingBlock, sliceIndex int) {
+	switch sliceIndex {
+	case 0:
+		m.pendingPrimeBlockCh <- pending
+	case 1:
+		m.pendingRegionBlockCh <- pending
+	case 2:
+		m.pendingZoneBlockCh <- pending
+	}
+}
 
-	// check for stale headers and refetch the latest header
-	if receiptBlock != nil && receiptBlock.Header().Number[sliceIndex] == m.combinedHeader.Number[sliceIndex] && err == nil {
-		switch sliceIndex {
-		case 0:
-			log.Println("Expected header numbers don't match for Prime at block height", receiptBlock.Header().Number[0])
-			log.Println("Retrying and attempting to refetch the latest header for Prime")
-		case 1:
-			log.Println("Expected header numbers don't match for Region at block height", receiptBlock.Header().Number[1])
-			log.Println("Retrying and attempting to refetch the latest header for Region")
-		case 2:
-			log.Println("Expected header numbers don't match for Zone at block height", receiptBlock.Header().Number[2])
-			log.Println("Retrying and attempting to refetch the latest header for Zone")
+// requestNewerPendingBlock requests the pending block of the context, refetching it while it is
+// older than the one being mined. It returns the location it was fetched for in case the location
+// changes while it is in flight. The lock is only held to take the location and the number being
+// mined, not across the requests.
+func (m *Manager) requestNewerPendingBlock(client *ethclient.Client, sliceIndex int) ([]byte, *types.ReceiptBlock, error) {
+	var location []byte
+	var mining *big.Int
+	m.withLock(func() {
+		location = append([]byte{}, m.location...)
+		if number := m.combinedHeader.Number[sliceIndex]; number != nil {
+			mining = new(big.Int).Set(number)
 		}
-		receiptBlock, err = client.GetPendingBlock(context.Background())
+	})
+	receiptBlock, err := m.requestPendingBlock(client, sliceIndex)
+
+	// refetch while the node has not caught up with the pending block being mined
+	for attempt := 1; attempt <= m.cfg().MaxStaleRefetches && err == nil && isStalePendingBlock(receiptBlock, mining, sliceIndex); attempt++ {
+		log.Println("Pending block is older than the one being mined", "context", contextNames[sliceIndex], "number", receiptBlock.Header().Number[sliceIndex], "mining", mining, "attempt", attempt)
+		receiptBlock, err = m.requestPendingBlock(client, sliceIndex)
 	}
+	return location, receiptBlock, err
+}
+
+// refetchOrphanedPendingBlock refetches the pending block of the context under the lock while it
+// is built on a parent that is no longer the head, e.g. while the node reorgs. It returns nil if
+// the node keeps serving an orphaned one.
+func (m *Manager) refetchOrphanedPendingBlock(client *ethclient.Client, receiptBlock *types.ReceiptBlock, sliceIndex int) *types.ReceiptBlock {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	orphaned := isOrphanedPendingBlock(client, receiptBlock, sliceIndex)
+	for attempt := 1; attempt <= m.cfg().MaxStaleRefetches && orphaned; attempt++ {
+		log.Println("Pending block is not built on the head", "context", contextNames[sliceIndex], "parent", receiptBlock.Header().ParentHash[sliceIndex], "attempt", attempt)
+		refetched, err := m.requestPendingBlock(client, sliceIndex)
+		if err != nil || refetched == nil {
+			break
+		}
+		receiptBlock = refetched
+		orphaned = isOrphanedPendingBlock(client, receiptBlock, sliceIndex)
+	}
+	if orphaned {
+		log.Println("Dropping pending block not built on the head", "context", contextNames[sliceIndex], "parent", receiptBlock.Header().ParentHash[sliceIndex])
+		return nil
+	}
+	return receiptBlock
+}
+
+// cfg returns the config of the manager. A reload replaces the config as a whole instead of
+// changing its fields, so the returned config never changes and must not be modified.
+func (m *Manager) cfg() *util.Config {
+	return m.config.Load().(*util.Config)
+}
+
+// currentLocation returns a copy of the location being mined.
+func (m *Manager) currentLocation() []byte {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]byte{}, m.location...)
+}
+
+// fetchPendingBlock fetches the pending block of the context, retrying until the node returns
+// one. It returns nil if the block is rejected as too old or is a duplicate of the last one.
+func (m *Manager) fetchPendingBlock(client *ethclient.Client, sliceIndex int) *pendingBlock {
+	location, receiptBlock, err := m.requestNewerPendingBlock(client, sliceIndex)
 
 	// retrying for 5 times if pending block not found
 	if err != nil || receiptBlock == nil {
 		log.Println("Pending block not found for index:", sliceIndex, "error:", err)
 		found := false
-		attempts := 0
-		lastUpdatedAt := time.Now()
 
+		// the lock is not held while backing off, not to hold up the other contexts
 		for !found {
-			if time.Now().Sub(lastUpdatedAt).Hours() >= 12 {
-				attempts = 0
-			}
-
-			receiptBlock, err = client.GetPendingBlock(context.Background())
-			if err == nil && receiptBlock != nil {
-				break
-			}
-			lastUpdatedAt = time.Now()
-			attempts += 1
+			// the attempts carry over from recent outages of the context, see backoff
+			attempts := m.fetchBackoffs[sliceIndex].Fail()
 
 			// exponential back-off implemented
-			delaySecs := int64(math.Floor((math.Pow(2, float64(attempts)) - 1) * 0.5))
-			if delaySecs > exponentialBackoffCeilingSecs {
-				delaySecs = exponentialBackoffCeilingSecs
-			}
+			delaySecs := cappedBackoffDelaySecs(attempts, m.maxFetchBackoff(sliceIndex))
 
 			// should only get here if the ffmpeg record stream process dies
 			fmt.Printf("This is attempt %d to fetch pending block. Waiting %d seconds and then retrying...\n", attempts, delaySecs)
 
 			time.Sleep(time.Duration(delaySecs) * time.Second)
+
+			receiptBlock, err = m.requestPendingBlock(client, sliceIndex)
+			if err == nil && receiptBlock != nil {
+				break
+			}
 		}
 	}
+	m.fetchBackoffs[sliceIndex].Succeed()
 
-	m.lock.Unlock()
-	switch sliceIndex {
-	case 0:
-		m.pendingPrimeBlockCh <- receiptBlock
-	case 1:
-		m.pendingRegionBlockCh <- receiptBlock
-	case 2:
-		m.pendingZoneBlockCh <- receiptBlock
+	// refetch templates built on a parent that is no longer the head, e.g. while the node reorgs
+	if m.cfg().VerifyPendingParent {
+		if receiptBlock = m.refetchOrphanedPendingBlock(client, receiptBlock, sliceIndex); receiptBlock == nil {
+			return nil
+		}
 	}
+
+	// reject templates of nodes that are lagging behind, they would be stale before they are mined
+	if maxAge := m.maxPendingBlockAge(sliceIndex); maxAge > 0 {
+		age := time.Since(time.Unix(int64(receiptBlock.Header().Time), 0))
+		if age > maxAge {
+			log.Println("Rejecting stale pending block", "context", contextNames[sliceIndex], "number", receiptBlock.Header().Number[sliceIndex], "age", age.Round(time.Second), "max", maxAge)
+			return nil
+		}
+	}
+
+	pending := &pendingBlock{block: receiptBlock, location: location}
+	if m.cfg().DedupPendingBlocks {
+		key := pending.key(sliceIndex)
+		var duplicate bool
+		m.withLock(func() {
+			duplicate = m.lastPendingKeys[sliceIndex] == key
+			m.lastPendingKeys[sliceIndex] = key
+		})
+		if duplicate {
+			return nil
+		}
+	}
+	return pending
+}
+
+// isOrphanedPendingBlock reports whether the parent of the pending block is not the head of the
+// node in the given context. A head that can't be fetched counts as matching.
+func isOrphanedPendingBlock(client *ethclient.Client, receiptBlock *types.ReceiptBlock, sliceIndex int) bool {
+	parents := receiptBlock.Header().ParentHash
+	if len(parents) <= sliceIndex {
+		return false
+	}
+	head, err := client.HeaderByNumber(context.Background(), nil)
+	if err != nil || head == nil {
+		return false
+	}
+	return head.Hash() != parents[sliceIndex]
+}
+
+// isStalePendingBlock reports whether the pending block is behind the number being mined in the
+// given context. Blocks at the mined number are template refreshes, e.g. for new transactions.
+func isStalePendingBlock(receiptBlock *types.ReceiptBlock, mining *big.Int, sliceIndex int) bool {
+	if receiptBlock == nil || receiptBlock.Header().Number[sliceIndex] == nil || mining == nil {
+		return false
+	}
+	return receiptBlock.Header().Number[sliceIndex].Cmp(mining) < 0
 }
 
 // updateCombinedHeader performs the merged mining step of combining all headers from the slice of nodes
 // being mined. This is then sent to the miner where a valid header is returned upon respective difficulties.
+// The time of the combined header is the latest time of the pending headers merged per context,
+// so that it follows every context's parent however their updates are ordered, and an update
+// replacing a context's header with an older one lowers it again instead of keeping the highest
+// time ever seen.
 func (m *Manager) updateCombinedHeader(header *types.Header, i int) {
 	m.lock.Lock()
-	time := header.Time
-	if time <= m.combinedHeader.Time {
-		time = m.combinedHeader.Time
+	defer m.lock.Unlock()
+	m.pendingTimes[i] = header.Time
+	time := uint64(0)
+	for _, pendingTime := range m.pendingTimes {
+		if pendingTime > time {
+			time = pendingTime
+		}
 	}
 	m.combinedHeader.ParentHash[i] = header.ParentHash[i]
 	m.combinedHeader.UncleHash[i] = header.UncleHash[i]
 	m.combinedHeader.Number[i] = header.Number[i]
 	m.combinedHeader.Extra[i] = header.Extra[i]
+	if m.extraData != nil {
+		m.combinedHeader.Extra[i] = m.extraData
+	}
 	m.combinedHeader.BaseFee[i] = header.BaseFee[i]
 	m.combinedHeader.GasLimit[i] = header.GasLimit[i]
 	m.combinedHeader.GasUsed[i] = header.GasUsed[i]
@@ -687,7 +1226,47 @@ func (m *Manager) updateCombinedHeader(header *types.Header, i int) {
 	m.combinedHeader.Bloom[i] = header.Bloom[i]
 	m.combinedHeader.Time = time
 	m.combinedHeader.Location = m.location
-	m.lock.Unlock()
+}
+
+// copyHeader returns a copy of the header that shares none of its per-context slices, unlike
+// types.CopyHeader, so that updating the combined header doesn't change a copy taken before.
+func copyHeader(header *types.Header) *types.Header {
+	cpy := *header
+	cpy.ParentHash = append([]common.Hash(nil), header.ParentHash...)
+	cpy.UncleHash = append([]common.Hash(nil), header.UncleHash...)
+	cpy.Coinbase = append([]common.Address(nil), header.Coinbase...)
+	cpy.Root = append([]common.Hash(nil), header.Root...)
+	cpy.TxHash = append([]common.Hash(nil), header.TxHash...)
+	cpy.ReceiptHash = append([]common.Hash(nil), header.ReceiptHash...)
+	cpy.Bloom = append([]types.Bloom(nil), header.Bloom...)
+	cpy.Difficulty = copyBigs(header.Difficulty)
+	cpy.NetworkDifficulty = copyBigs(header.NetworkDifficulty)
+	cpy.Number = copyBigs(header.Number)
+	cpy.GasLimit = append([]uint64(nil), header.GasLimit...)
+	cpy.GasUsed = append([]uint64(nil), header.GasUsed...)
+	cpy.Location = append([]byte(nil), header.Location...)
+	cpy.BaseFee = copyBigs(header.BaseFee)
+	if header.Extra != nil {
+		cpy.Extra = make([][]byte, len(header.Extra))
+		for i, extra := range header.Extra {
+			cpy.Extra[i] = append([]byte(nil), extra...)
+		}
+	}
+	return &cpy
+}
+
+// copyBigs copies the slice and every integer in it, nil entries stay nil.
+func copyBigs(values []*big.Int) []*big.Int {
+	if values == nil {
+		return nil
+	}
+	cpy := make([]*big.Int, len(values))
+	for i, value := range values {
+		if value != nil {
+			cpy[i] = new(big.Int).Set(value)
+		}
+	}
+	return cpy
 }
 
 // loopGlobalBlock takes in updates from the pending headers and blocks in order to update the miner.
@@ -696,53 +1275,79 @@ func (m *Manager) updateCombinedHeader(header *types.Header, i int) {
 func (m *Manager) loopGlobalBlock() error {
 	for {
 		select {
-		case block := <-m.pendingPrimeBlockCh:
-			header := block.Header()
-			m.updateCombinedHeader(header, 0)
-			m.pendingBlocks[0] = block
-			header.Nonce = types.BlockNonce{}
-			select {
-			case m.updatedCh <- m.combinedHeader:
-			default:
-				log.Println("Sealing result is not read by miner", "mode", "fake", "sealhash")
-			}
-		case block := <-m.pendingRegionBlockCh:
-			header := block.Header()
-			m.updateCombinedHeader(header, 1)
-			m.pendingBlocks[1] = block
-			header.Nonce = types.BlockNonce{}
-			select {
-			case m.updatedCh <- m.combinedHeader:
-			default:
-				log.Println("Sealing result is not read by miner", "mode", "fake", "sealhash")
-			}
-		case block := <-m.pendingZoneBlockCh:
-			header := block.Header()
-			m.updateCombinedHeader(header, 2)
-			m.pendingBlocks[2] = block
-			header.Nonce = types.BlockNonce{}
-			select {
-			case m.updatedCh <- m.combinedHeader:
-			default:
-				log.Println("Sealing result is not read by miner", "mode", "fake", "sealhash")
-			}
+		case pending := <-m.pendingPrimeBlockCh:
+			m.handlePendingBlock(pending, 0)
+		case pending := <-m.pendingRegionBlockCh:
+			m.handlePendingBlock(pending, 1)
+		case pending := <-m.pendingZoneBlockCh:
+			m.handlePendingBlock(pending, 2)
 		}
 	}
 }
 
+// handlePendingBlock merges a pending block into the combined header and notifies the miner.
+// Blocks that were fetched for a location other than the current one are discarded if configured.
+func (m *Manager) handlePendingBlock(pending *pendingBlock, sliceIndex int) {
+	location := m.currentLocation()
+	stale := !pending.matchesLocation(location, sliceIndex)
+	if stale && m.cfg().DiscardStalePendingBlocks {
+		log.Println("Discarding pending block fetched for another location", "context", contextNames[sliceIndex], "fetched", pending.location, "current", location)
+		return
+	}
+
+	header := pending.block.Header()
+	if selector := m.coinbaseSelector(sliceIndex); selector != nil && len(header.Coinbase) > sliceIndex && !selector.Matches(header.Coinbase[sliceIndex]) {
+		log.Println("Waiting for a pending block built for the selected coinbase", "context", contextNames[sliceIndex], "coinbase", header.Coinbase[sliceIndex])
+		return
+	}
+	m.updateCombinedHeader(header, sliceIndex)
+	m.withLock(func() { m.pendingBlocks[sliceIndex] = pending.block })
+	header.Nonce = types.BlockNonce{}
+	m.notifyMiner(header, sliceIndex)
+	m.publishWork()
+}
+
+// publishWork queues a snapshot of the combined header and the pending blocks it was assembled
+// from for the work queue, if one is configured.
+func (m *Manager) publishWork() {
+	if m.workQueue == nil || m.headerNullCheck() != nil {
+		return
+	}
+	work := &queuedWork{}
+	m.withLock(func() {
+		work.header = copyHeader(m.combinedHeader)
+		work.pending = append([]*types.ReceiptBlock{}, m.pendingBlocks...)
+		work.location = append([]byte{}, m.location...)
+	})
+	m.workQueue.Enqueue(work)
+}
+
+// notifyMiner hands the combined header to the miner after the given context was updated.
+// If the miner has not consumed the previous update yet the update is dropped and counted.
+func (m *Manager) notifyMiner(header *types.Header, sliceIndex int) {
+	select {
+	case m.updatedCh <- m.combinedHeader:
+	default:
+		droppedUpdatesCounters[sliceIndex].Inc(1)
+		log.Println("Sealing result is not read by miner", "context", contextNames[sliceIndex], "number", header.Number[sliceIndex], "dropped", droppedUpdatesCounters[sliceIndex].Count())
+	}
+}
+
 // check if the header is null. If so, don't start mining.
+// The wait for a context is only logged once until its header information arrives.
 func (m *Manager) headerNullCheck() error {
 	err := errors.New("header has nil value, cannot continue with mining")
-	if m.combinedHeader.Number[0] == nil {
-		log.Println("Waiting to retrieve Prime header information...")
-		return err
-	}
-	if m.combinedHeader.Number[1] == nil {
-		log.Println("Waiting to retrieve Region header information...")
-		return err
-	}
-	if m.combinedHeader.Number[2] == nil {
-		log.Println("Waiting to retrieve Zone header information...")
+	for i, name := range []string{"Prime", "Region", "Zone"} {
+		if i == 0 && !m.cfg().HasPrime {
+			continue
+		}
+		if m.combinedHeader.Number[i] != nil {
+			atomic.StoreInt32(&m.waitingLogged[i], 0)
+			continue
+		}
+		if atomic.CompareAndSwapInt32(&m.waitingLogged[i], 0, 1) {
+			log.Println("Waiting to retrieve " + name + " header information...")
+		}
 		return err
 	}
 	return nil
@@ -751,8 +1356,16 @@ func (m *Manager) headerNullCheck() error {
 // miningLoop iterates on a new header and passes the result to m.resultCh. The result is called within the method.
 func (m *Manager) miningLoop() error {
 	var (
-		stopCh chan struct{}
+		stopCh      chan struct{}
+		sealStarted time.Time
+		// deferred is the latest header received while the current seal was inside its minimum
+		// run time, it is mined once debounce fires.
+		deferred *types.Header
+		debounce <-chan time.Time
 	)
+	minSealDuration := time.Duration(m.cfg().MinSealDuration) * time.Millisecond
+	heartbeat := time.NewTicker(miningHeartbeatInterval)
+	defer heartbeat.Stop()
 	// interrupt aborts the in-flight sealing task.
 	interrupt := func() {
 		if stopCh != nil {
@@ -760,27 +1373,81 @@ func (m *Manager) miningLoop() error {
 			stopCh = nil
 		}
 	}
+	seal := func(header *types.Header) {
+		// Mine the header here
+		// Return the valid header with proper nonce and mix digest
+		// Interrupt previous sealing operation
+		updated := m.seals.Update(header)
+		interrupt()
+		if atomic.LoadInt32(&m.economicPaused) == 1 {
+			return
+		}
+		stopCh = make(chan struct{})
+		stop := stopCh
+		sealStarted = time.Now()
+		// The header is sealed together with the pending blocks and location it was merged
+		// from, taken under the lock, so that a switch or new pending block while sealing
+		// doesn't change the work or the bodies the found block is submitted with.
+		var pending []*types.ReceiptBlock
+		var location []byte
+		m.withLock(func() {
+			header = copyHeader(header)
+			pending = append([]*types.ReceiptBlock{}, m.pendingBlocks...)
+			location = append([]byte{}, m.location...)
+		})
+
+		headerNull := m.headerNullCheck()
+		if headerNull == nil {
+			sealHash := m.engine.SealHash(header)
+			log.Println("Starting to mine:  ", header.Number, "location", location, "difficulty", formatDifficulties(header.Difficulty), "sealHash", sealHash)
+			m.seals.Start(updated, sealHash)
+			results := make(chan *types.HeaderBundle, 1)
+			if err := m.engine.SealHeader(header, results, stopCh); err != nil {
+				m.seals.Stop()
+				log.Println("Block sealing failed", "err", err)
+				return
+			}
+			goRecovered("forwardSeal", func() { m.forwardSeal(results, stop, pending, location) })
+		}
+	}
 	for {
 		select {
 		case header := <-m.updatedCh:
-			// Mine the header here
-			// Return the valid header with proper nonce and mix digest
-			// Interrupt previous sealing operation
-			interrupt()
-			stopCh = make(chan struct{})
-			// See if we can grab the lock in order to start mining
-			// Lock should be held while sending mined blocks
-			// Reduce race conditions while sending mined blocks and waiting for pending headers
-			m.lock.Lock()
-			m.lock.Unlock()
-
-			headerNull := m.headerNullCheck()
-			if headerNull == nil {
-				log.Println("Starting to mine:  ", header.Number, "location", m.location, "difficulty", header.Difficulty)
-				if err := m.engine.SealHeader(header, m.resultCh, stopCh); err != nil {
-					log.Println("Block sealing failed", "err", err)
+			// give the running seal its minimum run time, coalescing the updates meanwhile
+			if wait := minSealDuration - time.Since(sealStarted); stopCh != nil && wait > 0 {
+				deferred = header
+				if debounce == nil {
+					debounce = time.After(wait)
 				}
+				continue
+			}
+			deferred, debounce = nil, nil
+			seal(header)
+		case <-debounce:
+			debounce = nil
+			if deferred != nil {
+				header := deferred
+				deferred = nil
+				seal(header)
 			}
+		case <-heartbeat.C:
+			atomic.StoreInt64(&m.miningHeartbeat, time.Now().UnixNano())
+		}
+	}
+}
+
+// forwardSeal passes the solution of one seal to m.resultCh with the pending blocks and location
+// the seal was started with. A solution the engine found by the time the seal is interrupted is
+// still passed on.
+func (m *Manager) forwardSeal(results <-chan *types.HeaderBundle, stop <-chan struct{}, pending []*types.ReceiptBlock, location []byte) {
+	select {
+	case bundle := <-results:
+		m.resultCh <- &minedResult{HeaderBundle: bundle, pending: pending, location: location}
+	case <-stop:
+		select {
+		case bundle := <-results:
+			m.resultCh <- &minedResult{HeaderBundle: bundle, pending: pending, location: location}
+		default:
 		}
 	}
 }
@@ -796,113 +1463,290 @@ func (m *Manager) SubmitHashRate() {
 	id := crypto.Keccak256Hash(randomIdArray)
 
 	var null float64 = 0
-	go func() {
+	safeGo("SubmitHashRate", func() {
+		var heartbeatErr error
 		for {
 			select {
 			case <-ticker.C:
 				hashRate := m.engine.Hashrate()
-				if hashRate != null {
+				if hashRate != null || m.cfg().ReportZeroHashrate {
 					log.Println("Quai Miner - current hashes per second: ", hashRate)
 					m.engine.SubmitHashrate(hexutil.Uint64(hashRate), id)
 				}
+				// the zone node gets the rate even when it is zero, so that it can tell an idle
+				// miner from one that is gone
+				err := m.submitNodeHashrate(hexutil.Uint64(hashRate), id)
+				if err != nil && (heartbeatErr == nil || err.Error() != heartbeatErr.Error()) {
+					log.Println("Failed to submit hashrate to the zone node", "err", err)
+				}
+				heartbeatErr = err
 			}
 		}
-	}()
+	})
+}
+
+// submitNodeHashrate reports the hashrate to the node of the mined zone.
+func (m *Manager) submitNodeHashrate(rate hexutil.Uint64, id common.Hash) error {
+	var client *rpc.Client
+	m.withLock(func() { client = m.activeSlice().chains[2].rpc })
+	if client == nil {
+		return nil
+	}
+	var accepted bool
+	return client.CallContext(context.Background(), &accepted, "eth_submitHashrate", rate, id)
 }
 
-// resultLoop takes in the result and passes to the proper channels for receiving.
+// resultLoop takes in the result and passes it to the submission loop of the context it is
+// submitted for, so that a slow submission of one context doesn't hold up the others.
+// Both stop once shutdownCh is closed, so that the queued results can be spooled.
 func (m *Manager) resultLoop() error {
+	m.submitLoops.Add(1)
+	defer m.submitLoops.Done()
+	// time of the first submission attempt of the mined blocks waiting for chains to come online
+	firstTried := make(map[common.Hash]time.Time)
+	for i := range m.submitChs {
+		i := i
+		safeGo(fmt.Sprint("submitLoop ", contextNames[i]), func() { m.submitLoop(i) })
+	}
 	for {
+		if m.shuttingDown() {
+			return nil
+		}
 		select {
+		case <-m.shutdownCh:
+			return nil
 		case bundle := <-m.resultCh:
-			m.lock.Lock()
 			header := bundle.Header
+			_, retried := firstTried[header.Hash()]
 
-			if bundle.Context == 0 {
+			if retried {
+				log.Println("Resubmitting mined block", "hash", header.Hash())
+			} else if bundle.Context == 0 {
 				log.Println(color.Ize(color.Red, "PRIME block mined"))
 				log.Println("PRIME:", header.Number, header.Hash())
-			}
-
-			if bundle.Context == 1 {
+			} else if bundle.Context == 1 {
 				log.Println(color.Ize(color.Yellow, "REGION block mined"))
 				log.Println("REGION:", header.Number, header.Hash())
-			}
-
-			if bundle.Context == 2 {
+			} else if bundle.Context == 2 {
 				log.Println(color.Ize(color.Blue, "Zone block mined"))
 				log.Println("ZONE:", header.Number, header.Hash())
 			}
+			if !retried {
+				sealHash := m.engine.SealHash(header)
+				m.seals.Found(sealHash, bundle.Context)
+				m.minedGaps.Record(bundle.Context)
+				if m.archive != nil && bundle.Context >= 0 && bundle.Context < len(bundle.pending) {
+					m.archive.Archive(bundle.Context, header, bundle.pending[bundle.Context], bundle.location)
+				}
+				m.nonces.Record(bundle.Context, sealHash, header.Nonce)
+				if m.cfg().ProofDir != "" {
+					if err := writeProof(m.cfg().ProofDir, bundle.Context, sealHash, header); err != nil {
+						log.Println("Failed to write mined block proof", "hash", header.Hash(), "err", err)
+					}
+				}
+			}
+
+			// A block meeting the difficulty of a disabled context also meets the lower ones,
+			// so it is submitted for the highest enabled context it qualifies for.
+			submitted := m.submissionContext(bundle.Context)
+			if submitted < 0 {
+				log.Println("Mining is disabled for the context of the mined block", "context", bundle.Context)
+				delete(firstTried, header.Hash())
+				continue
+			}
+			// the next templates are built for the next coinbase while this block is submitted
+			if !retried {
+				m.advanceCoinbases(submitted, header)
+			}
 
 			// Check to see that all nodes are running before sending blocks to them.
 			if !m.allChainsOnline() {
-				log.Println("At least one of the chains is not online at the moment")
+				m.retryOffline(bundle, firstTried)
 				continue
 			}
+			delete(firstTried, header.Hash())
 
-			// Check proper difficulty for which nodes to send block to
-			// Notify blocks to put in cache before assembling new block on node
-			if bundle.Context == 0 && header.Number[0] != nil {
-				var wg sync.WaitGroup
-				wg.Add(1)
-				go m.SendClientsMinedExtBlock(0, []int{1, 2}, header, &wg)
-				wg.Add(1)
-				go m.SendClientsMinedExtBlock(1, []int{0, 2}, header, &wg)
-				wg.Add(1)
-				go m.SendClientsMinedExtBlock(2, []int{0, 1}, header, &wg)
-				wg.Wait()
-				wg.Add(1)
-				go m.SendMinedBlock(2, header, &wg)
-				wg.Add(1)
-				go m.SendMinedBlock(1, header, &wg)
-				wg.Add(1)
-				go m.SendMinedBlock(0, header, &wg)
-				wg.Wait()
+			select {
+			case m.submitChs[submitted] <- bundle:
+			case <-m.shutdownCh:
+				m.withLock(func() { m.unqueued = append(m.unqueued, bundle) })
+				return nil
 			}
+		}
+	}
+}
 
-			// If Region difficulty send to Region
-			if bundle.Context == 1 && header.Number[1] != nil {
-				var wg sync.WaitGroup
-				wg.Add(1)
-				go m.SendClientsMinedExtBlock(1, []int{0, 2}, header, &wg)
-				wg.Add(1)
-				go m.SendClientsMinedExtBlock(2, []int{0, 1}, header, &wg)
-				wg.Wait()
-				wg.Add(1)
-				go m.SendMinedBlock(2, header, &wg)
-				wg.Add(1)
-				go m.SendMinedBlock(1, header, &wg)
-				wg.Wait()
-			}
+// submitLoop submits the mined blocks of one context and relays them as external blocks, with
+// the pending blocks and location they were sealed with. The lock is not held while the blocks
+// are sent. The location only applies to headers that don't carry their own. A submission in
+// flight when shutdownCh is closed is finished, the queued ones are left for the spool.
+func (m *Manager) submitLoop(submitted int) {
+	m.submitLoops.Add(1)
+	defer m.submitLoops.Done()
+	for {
+		if m.shuttingDown() {
+			return
+		}
+		select {
+		case <-m.shutdownCh:
+			return
+		case result := <-m.submitChs[submitted]:
+			m.submitMined(submitted, result.Header, result.pending, result.location)
+		}
+	}
+}
 
-			// If Zone difficulty send to Zone
-			if bundle.Context == 2 && header.Number[2] != nil {
-				var wg sync.WaitGroup
-				wg.Add(1)
-				go m.SendClientsMinedExtBlock(2, []int{0, 1}, header, &wg)
-				wg.Wait()
-				wg.Add(1)
-				go m.SendMinedBlock(2, header, &wg)
-				wg.Wait()
+// shuttingDown reports whether shutdownCh is closed. The loops check it before waiting for the
+// next result, which a select could otherwise prefer over the closed channel.
+func (m *Manager) shuttingDown() bool {
+	select {
+	case <-m.shutdownCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// submitMined submits the mined header for the submitted context with the bodies of the pending
+// blocks, relaying it as an external block first. The header is sent to the chains of the location
+// it was sealed for, location is used for headers without a valid one.
+func (m *Manager) submitMined(submitted int, header *types.Header, pending []*types.ReceiptBlock, location []byte) {
+	if m.orderedBlockClients.checkZone(header.Location) == nil {
+		location = append([]byte{}, header.Location...)
+	}
+	if header.Number[submitted] == nil {
+		if header = m.backfillNumber(header, submitted, pending); header == nil {
+			return
+		}
+	}
+	// POST /abort cancels the context to stop the submission while it is in flight
+	ctx, done := m.submissions.Start(submitted, header.Hash())
+
+	// Check proper difficulty for which nodes to send block to
+	// Notify blocks to put in cache before assembling new block on node
+	if submitted == 0 && header.Number[0] != nil {
+		var wg sync.WaitGroup
+		wg.Add(1)
+		goRecovered("SendClientsMinedExtBlock", func() { m.SendClientsMinedExtBlock(ctx, 0, []int{1, 2}, header, pending, &wg) })
+		wg.Add(1)
+		goRecovered("SendClientsMinedExtBlock", func() { m.SendClientsMinedExtBlock(ctx, 1, []int{0, 2}, header, pending, &wg) })
+		wg.Add(1)
+		goRecovered("SendClientsMinedExtBlock", func() { m.SendClientsMinedExtBlock(ctx, 2, []int{0, 1}, header, pending, &wg) })
+		wg.Wait()
+		wg.Add(1)
+		goRecovered("SendMinedBlock", func() { m.SendMinedBlock(ctx, 2, header, pending, location, &wg) })
+		wg.Add(1)
+		goRecovered("SendMinedBlock", func() { m.SendMinedBlock(ctx, 1, header, pending, location, &wg) })
+		wg.Add(1)
+		goRecovered("SendMinedBlock", func() { m.SendMinedBlock(ctx, 0, header, pending, location, &wg) })
+		wg.Wait()
+	}
+
+	// If Region difficulty send to Region
+	if submitted == 1 && header.Number[1] != nil {
+		var wg sync.WaitGroup
+		wg.Add(1)
+		goRecovered("SendClientsMinedExtBlock", func() { m.SendClientsMinedExtBlock(ctx, 1, []int{0, 2}, header, pending, &wg) })
+		wg.Add(1)
+		goRecovered("SendClientsMinedExtBlock", func() { m.SendClientsMinedExtBlock(ctx, 2, []int{0, 1}, header, pending, &wg) })
+		wg.Wait()
+		wg.Add(1)
+		goRecovered("SendMinedBlock", func() { m.SendMinedBlock(ctx, 2, header, pending, location, &wg) })
+		wg.Add(1)
+		goRecovered("SendMinedBlock", func() { m.SendMinedBlock(ctx, 1, header, pending, location, &wg) })
+		wg.Wait()
+	}
+
+	// If Zone difficulty send to Zone
+	if submitted == 2 && header.Number[2] != nil {
+		var wg sync.WaitGroup
+		wg.Add(1)
+		goRecovered("SendClientsMinedExtBlock", func() { m.SendClientsMinedExtBlock(ctx, 2, []int{0, 1}, header, pending, &wg) })
+		wg.Wait()
+		wg.Add(1)
+		goRecovered("SendMinedBlock", func() { m.SendMinedBlock(ctx, 2, header, pending, location, &wg) })
+		wg.Wait()
+	}
+	aborted := ctx.Err() != nil
+	done()
+	if aborted {
+		log.Println("Aborted mined block submission", "context", contextNames[submitted], "hash", header.Hash())
+		return
+	}
+
+	// the block was sealed for the submitted context and all contexts below it
+	for i := submitted; i < len(m.coinbases); i++ {
+		if header.Number[i] == nil {
+			continue
+		}
+		if pending[i] != nil {
+			txs, uncles := len(pending[i].Transactions()), len(pending[i].Uncles())
+			minedBlocksCounters[i].Inc(1)
+			minedTxsCounters[i].Inc(int64(txs))
+			minedUnclesCounters[i].Inc(int64(uncles))
+			log.Println("Mined block body", "context", contextNames[i], "number", header.Number[i], "txs", txs, "uncles", uncles)
+		}
+	}
+}
+
+// errMissingNumber is recorded for mined blocks whose header has no number for the context
+// they are submitted for and couldn't be backfilled.
+var errMissingNumber = errors.New("no number for the mined context")
+
+// backfillNumber returns the mined header with the number of the submitted context taken from
+// its pending block, if BackfillMinedNumbers is set and the seal still meets the difficulty of
+// the context with it. The number is part of the seal hash, so it often doesn't. Otherwise the
+// block is dropped and nil is returned.
+func (m *Manager) backfillNumber(header *types.Header, submitted int, pending []*types.ReceiptBlock) *types.Header {
+	log.Println("Mined block has no number for its context", "context", contextNames[submitted], "hash", header.Hash())
+	if m.cfg().BackfillMinedNumbers && pending[submitted] != nil {
+		number := pending[submitted].Header().Number
+		if len(number) > submitted && number[submitted] != nil {
+			backfilled := *header
+			backfilled.Number = append([]*big.Int{}, header.Number...)
+			backfilled.Number[submitted] = new(big.Int).Set(number[submitted])
+			order, err := m.engine.GetDifficultyOrder(&backfilled)
+			if err == nil && order <= submitted {
+				log.Println("Backfilled the number of the mined block from its pending block", "context", contextNames[submitted], "number", backfilled.Number[submitted])
+				return &backfilled
 			}
-			m.lock.Unlock()
+			log.Println("Seal does not meet the difficulty with the backfilled number", "context", contextNames[submitted], "number", number[submitted])
+		}
+	}
+	m.minedSubmissions.Record(submitted, errMissingNumber)
+	log.Println("Dropping mined block", "context", contextNames[submitted], "number", header.Number, "err", errMissingNumber)
+	return nil
+}
+
+// submissionContext returns the highest enabled context at or below the mined context, or -1 if
+// mining is disabled for all of them.
+func (m *Manager) submissionContext(mined int) int {
+	for i := mined; i < len(contextNames); i++ {
+		if i == 0 && !m.cfg().HasPrime {
+			continue
+		}
+		if m.mineContexts.Enabled(i) {
+			return i
 		}
 	}
+	return -1
 }
 
 // allChainsOnline checks if every single chain is online before sending the mined block to make sure that we don't have
-// external blocks not found error
+// external blocks not found error. Chains that have not connected yet when starting without RequireAllChains are skipped.
 func (m *Manager) allChainsOnline() bool {
-	if !checkConnection(m.orderedBlockClients.primeClient) {
+	clients := m.chainStates()
+	if m.cfg().HasPrime && !checkConnection(clients.prime) {
 		return false
 	}
-	for _, blockClient := range m.orderedBlockClients.regionClients {
-		if !checkConnection(blockClient) {
+	for _, region := range clients.regions {
+		if region.client != nil && !checkConnection(region) {
 			return false
 		}
 	}
-	for i := range m.orderedBlockClients.zoneClients {
-		for _, blockClient := range m.orderedBlockClients.zoneClients[i] {
-			if !checkConnection(blockClient) {
+	for i := range clients.zones {
+		for _, zone := range clients.zones[i] {
+			if zone.client != nil && !checkConnection(zone) {
 				return false
 			}
 		}
@@ -911,182 +1755,383 @@ func (m *Manager) allChainsOnline() bool {
 }
 
 // SendClientsMinedExtBlock takes in the mined block and calls the pending blocks to send to the clients.
-func (m *Manager) SendClientsMinedExtBlock(mined int, externalContexts []int, header *types.Header, wg *sync.WaitGroup) {
-	receiptBlock := m.pendingBlocks[mined]
+func (m *Manager) SendClientsMinedExtBlock(ctx context.Context, mined int, externalContexts []int, header *types.Header, pending []*types.ReceiptBlock, wg *sync.WaitGroup) {
+	defer wg.Done()
+	receiptBlock := pending[mined]
 	if receiptBlock != nil {
 		block := types.NewBlockWithHeader(header).WithBody(receiptBlock.Transactions(), receiptBlock.Uncles())
-		m.SendClientsExtBlock(mined, externalContexts, block, receiptBlock)
+		m.SendClientsExtBlock(ctx, mined, externalContexts, block, receiptBlock)
 	}
-	defer wg.Done()
 }
 
 // SendClientsExtBlock takes in the mined block and the contexts of the mining slice to send the external block to.
 // ex. mined 2, externalContexts []int{0, 1} will send the Zone external block to Prime and Region.
-func (m *Manager) SendClientsExtBlock(mined int, externalContexts []int, block *types.Block, receiptBlock *types.ReceiptBlock) {
+func (m *Manager) SendClientsExtBlock(ctx context.Context, mined int, externalContexts []int, block *types.Block, receiptBlock *types.ReceiptBlock) {
 	// first send the external block to the mining chains
-	blockLocation := block.Header().Location
-	if blockLocation == nil || len(blockLocation) == 0 {
+	blockLocation := append([]byte{}, block.Header().Location...)
+	if len(blockLocation) == 0 {
+		return
+	}
+	if err := m.orderedBlockClients.checkZone(blockLocation); err != nil {
+		log.Println("Not relaying external block with an invalid location", "hash", block.Hash(), "context", mined, "err", err)
+		return
+	}
+	if err := m.checkExternalContext(block.Header(), mined); err != nil {
+		log.Println("Not relaying external block with a mismatched context", "hash", block.Hash(), "context", mined, "err", err)
 		return
 	}
 
+	mining := m.sliceAt(blockLocation)
+	states := m.chainStates()
+	var miningTargets []relayTarget
 	for i := 0; i < len(externalContexts); i++ {
-		if externalContexts[i] == 0 && m.orderedBlockClients.primeAvailable {
-			m.orderedBlockClients.primeClient.SendExternalBlock(context.Background(), block, receiptBlock.Receipts(), big.NewInt(int64(mined)))
+		if externalContexts[i] == 0 && states.prime.available {
+			miningTargets = append(miningTargets, relayTarget{location: []byte{0, 0}, client: states.prime.relayClient()})
 		}
-		if externalContexts[i] == 1 && m.orderedBlockClients.regionsAvailable[blockLocation[0]-1] {
-			m.orderedBlockClients.regionClients[blockLocation[0]-1].SendExternalBlock(context.Background(), block, receiptBlock.Receipts(), big.NewInt(int64(mined)))
-		}
-		if externalContexts[i] == 2 && m.orderedBlockClients.zonesAvailable[blockLocation[0]-1][blockLocation[1]-1] {
-			m.orderedBlockClients.zoneClients[blockLocation[0]-1][blockLocation[1]-1].SendExternalBlock(context.Background(), block, receiptBlock.Receipts(), big.NewInt(int64(mined)))
+		if externalContext := externalContexts[i]; externalContext == 1 || externalContext == 2 {
+			if chain := m.chainState(mining.chains[externalContext]); chain.available {
+				miningTargets = append(miningTargets, relayTarget{location: mining.locations[externalContext], client: chain.relayClient()})
+			}
 		}
 	}
+	m.relayExternalBlock(ctx, m.withoutLagging(miningTargets, block.Hash()), block, receiptBlock.Receipts(), mined)
+
+	// leave the other chains to request the block through subscribeMissingExternalBlock
+	if m.cfg().ReactiveExternalRelayOnly {
+		return
+	}
+
 	// sending the external blocks to chains other than the mining chains
-	for i, blockClient := range m.orderedBlockClients.regionClients {
-		miningRegion := int(blockLocation[0])-1 == i
-		if !miningRegion {
-			blockClient.SendExternalBlock(context.Background(), block, receiptBlock.Receipts(), big.NewInt(int64(mined)))
+	var otherTargets []relayTarget
+	miningRegion, miningZone := mining.locations[1], mining.locations[2]
+	for i, region := range states.regions {
+		if int(miningRegion[0])-1 != i {
+			otherTargets = append(otherTargets, relayTarget{location: []byte{uint8(i + 1), 0}, client: region.relayClient()})
 		}
 	}
 
-	for i := range m.orderedBlockClients.zoneClients {
-		for j, blockClient := range m.orderedBlockClients.zoneClients[i] {
-			miningZone := int(blockLocation[0])-1 == i && int(blockLocation[1])-1 == j
-			if !miningZone {
-				blockClient.SendExternalBlock(context.Background(), block, receiptBlock.Receipts(), big.NewInt(int64(mined)))
+	for i := range states.zones {
+		for j, zone := range states.zones[i] {
+			if int(miningZone[0])-1 != i || int(miningZone[1])-1 != j {
+				otherTargets = append(otherTargets, relayTarget{location: []byte{uint8(i + 1), uint8(j + 1)}, client: zone.relayClient()})
 			}
 		}
 	}
+	m.relayExternalBlock(ctx, m.withoutLagging(otherTargets, block.Hash()), block, receiptBlock.Receipts(), mined)
+}
 
+// checkExternalContext verifies that the header is a block of the context it is about to be
+// relayed as: it has a number in that context and its seal meets the context's difficulty.
+func (m *Manager) checkExternalContext(header *types.Header, difficultyContext int) error {
+	if difficultyContext < 0 || difficultyContext >= len(contextNames) {
+		return fmt.Errorf("invalid context %d", difficultyContext)
+	}
+	if len(header.Number) <= difficultyContext || header.Number[difficultyContext] == nil {
+		return fmt.Errorf("no %s number", contextNames[difficultyContext])
+	}
+	order, err := m.engine.GetDifficultyOrder(header)
+	if err != nil {
+		return err
+	}
+	if order > difficultyContext {
+		return fmt.Errorf("seal only meets the %s difficulty", contextNames[order])
+	}
+	return nil
 }
 
-// SendMinedBlock sends the mined block to its mining client with the transactions, uncles, and receipts.
-func (m *Manager) SendMinedBlock(mined int, header *types.Header, wg *sync.WaitGroup) {
-	receiptBlock := m.pendingBlocks[mined]
-	block := types.NewBlockWithHeader(receiptBlock.Header()).WithBody(receiptBlock.Transactions(), receiptBlock.Uncles())
-	if block != nil {
-		sealed := block.WithSeal(header)
-		if mined == 0 {
-			m.orderedBlockClients.primeClient.SendMinedBlock(context.Background(), sealed, true, true)
+// sendExternalBlock sends the external block mined in the given context to the client of the
+// chain at the target location. If VerifyExternalBlocks is set, it confirms the node stored the
+// block and resends it up to ExternalBlockResends times if it didn't.
+func (m *Manager) sendExternalBlock(ctx context.Context, target []byte, client *ethclient.Client, block *types.Block, receipts []*types.Receipt, mined int) error {
+	err := m.postExternalBlock(ctx, target, client, block, receipts, mined)
+	if err != nil || !m.cfg().VerifyExternalBlocks {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		if stored, _ := client.GetExternalBlockByHashAndContext(ctx, block.Hash(), mined); stored != nil {
+			return nil
 		}
-		if mined == 1 {
-			m.orderedBlockClients.regionClients[m.location[0]-1].SendMinedBlock(context.Background(), sealed, true, true)
+		if attempt > m.cfg().ExternalBlockResends {
+			return fmt.Errorf("external block not stored after %d resends", m.cfg().ExternalBlockResends)
 		}
-		if mined == 2 {
-			m.orderedBlockClients.zoneClients[m.location[0]-1][m.location[1]-1].SendMinedBlock(context.Background(), sealed, true, true)
+		log.Println("External block not found on node, resending", "hash", block.Hash(), "context", mined, "attempt", attempt)
+		if err = client.SendExternalBlock(ctx, block, receipts, big.NewInt(int64(mined))); err != nil {
+			return err
 		}
 	}
-	defer wg.Done()
 }
 
-// Checks if a connection is still there on orderedBlockClient.chainAvailable
-func checkConnection(client *ethclient.Client) bool {
-	_, err := client.HeaderByNumber(context.Background(), nil)
+// postExternalBlock sends the external block mined in the given context to the client of the
+// chain at the target location, batched with the other external blocks sent to the chain if
+// ExternalBatchWindow is set.
+func (m *Manager) postExternalBlock(ctx context.Context, target []byte, client *ethclient.Client, block *types.Block, receipts []*types.Receipt, mined int) error {
+	send := func() error {
+		return client.SendExternalBlock(ctx, block, receipts, big.NewInt(int64(mined)))
+	}
+	if m.externalBatcher == nil {
+		return send()
+	}
+	return m.externalBatcher.Send(ctx, target, m.orderedBlockClients.at(target).rpc, block, receipts, mined, send)
+}
+
+// logSend logs a failed send of a block to the chain at the target location together with the
+// URL of its node. Successful sends are logged too if LogSubmissionTargets is set.
+func (m *Manager) logSend(kind string, target []byte, hash common.Hash, difficultyContext int, err error) {
 	if err != nil {
-		log.Println("Error: connection lost")
-		log.Println(err)
-		return false
-	} else {
-		return true
+		log.Println("Failed to send "+kind, "target", target, "url", m.orderedBlockClients.url(target), "context", contextNames[difficultyContext], "hash", hash, "err", err)
+	} else if m.cfg().LogSubmissionTargets {
+		log.Println("Sent "+kind, "target", target, "url", m.orderedBlockClients.url(target), "context", contextNames[difficultyContext], "hash", hash)
 	}
 }
 
-// Examines the Quai Network to find the Region-Zone location with lowest difficulty.
-func findBestLocation(clients orderedBlockClients) []byte {
-	lowestRegion := big.NewInt(math.MaxInt) // integer for holding lowest Region difficulty
-	lowestZone := big.NewInt(math.MaxInt)   // integer for holding lowest Zone difficulty
-	var regionLocation int                  // remember to return location as []byte with Zone1-1 = [1,1]
-	var zoneLocation int
+// minedBlockEncoding returns the inclTx and fullTx arguments of quai_sendMinedBlock for the
+// context: whether the transactions are included and whether as full objects or only hashes.
+func (m *Manager) minedBlockEncoding(difficultyContext int) (bool, bool) {
+	encoding := []util.MinedBlockEncoding{m.cfg().MinedBlockEncodings.Prime, m.cfg().MinedBlockEncodings.Region, m.cfg().MinedBlockEncodings.Zone}[difficultyContext]
+	return encoding.InclTx, encoding.FullTx
+}
 
-	// first find the Region chain with lowest difficulty
-	for i, client := range clients.regionClients {
-		latestHeader, err := client.HeaderByNumber(context.Background(), nil)
-		if err != nil {
-			log.Println("Error: connection lost during request")
-			log.Println(err)
-		} else {
-			difficulty := latestHeader.Difficulty[1]
-			if difficulty.Cmp(lowestRegion) == -1 {
-				regionLocation = i + 1
-				lowestRegion = difficulty
-			}
-			fmt.Println("region ", i+1, " difficulty ", difficulty)
+// errNoPendingBlock is recorded for mined blocks whose pending block is gone, e.g. because the
+// location switched while they were mined.
+var errNoPendingBlock = errors.New("no pending block for the mined context")
+
+// SendMinedBlock sends the mined block to its mining client with the transactions, uncles, and receipts.
+func (m *Manager) SendMinedBlock(ctx context.Context, mined int, header *types.Header, pending []*types.ReceiptBlock, location []byte, wg *sync.WaitGroup) {
+	defer wg.Done()
+	receiptBlock := pending[mined]
+	if receiptBlock == nil {
+		m.minedSubmissions.Record(mined, errNoPendingBlock)
+		log.Println("Dropping mined block", "context", contextNames[mined], "number", header.Number, "err", errNoPendingBlock)
+		return
+	}
+	// the location is the one the block was sealed for, a switch since then doesn't change the
+	// chain the block is sent to
+	if mined > 0 {
+		if err := m.orderedBlockClients.checkZone(location); err != nil {
+			m.minedSubmissions.Record(mined, err)
+			log.Println("Dropping mined block", "context", contextNames[mined], "number", header.Number, "err", err)
+			return
 		}
 	}
-	// next find Zone chain inside Region with lowest difficulty
-	for i, client := range clients.zoneClients[regionLocation-1] {
-		latestHeader, err := client.HeaderByNumber(context.Background(), nil)
-		if err != nil {
-			log.Println("Error: connect lost during request")
-			log.Println(err)
-		} else {
-			difficulty := latestHeader.Difficulty[2]
-			if difficulty.Cmp(lowestZone) == -1 {
-				zoneLocation = i + 1
-				lowestZone = difficulty
+	block := types.NewBlockWithHeader(receiptBlock.Header()).WithBody(receiptBlock.Transactions(), receiptBlock.Uncles())
+	if block != nil {
+		sealed := block.WithSeal(header)
+		inclTx, fullTx := m.minedBlockEncoding(mined)
+		slice := m.sliceAt(location)
+		target := slice.locations[mined]
+		// the prime client is replaced under the lock when prime fails over
+		var client *ethclient.Client
+		m.withLock(func() { client = slice.chains[mined].client })
+		err := client.SendMinedBlock(ctx, sealed, inclTx, fullTx)
+		if err != nil && ctx.Err() == nil {
+			reason, code, recoverable := rejectionReason(err)
+			log.Println("Node rejected mined block", "target", target, "context", contextNames[mined], "hash", sealed.Hash(), "reason", reason, "code", code)
+			if recoverable && m.cfg().ResubmitRejectedBlocks {
+				err = m.resubmitRejected(ctx, mined, header, pending, target, client, sealed, inclTx, fullTx)
 			}
-			fmt.Println("zone ", i+1, " difficulty ", difficulty)
 		}
+		m.minedSubmissions.Record(mined, err)
+		m.logSend("mined block", target, sealed.Hash(), mined, err)
+		if err == nil {
+			m.acceptance.Track(mined, [2]byte{target[0], target[1]}, sealed.Header())
+		}
+	}
+}
+
+// newSubmitChannels creates the queues of the mined headers of every context.
+func newSubmitChannels() []chan *minedResult {
+	chs := make([]chan *minedResult, len(contextNames))
+	for i := range chs {
+		chs[i] = make(chan *minedResult, resultQueueSize)
 	}
+	return chs
+}
 
-	// print location selected
-	fmt.Println("Region location selected: ", regionLocation)
-	fmt.Println("Zone location selected: ", zoneLocation)
-	regionBytes := make([]byte, 8)
-	zoneBytes := make([]byte, 8)
-	binary.LittleEndian.PutUint64(regionBytes, uint64(regionLocation))
-	binary.LittleEndian.PutUint64(zoneBytes, uint64(zoneLocation))
-	// return location to config
-	return []byte{regionBytes[0], zoneBytes[0]}
+// retryOffline resubmits a mined block that found a chain offline after offlineRetryInterval,
+// until OfflineSubmitGrace seconds have passed since its first attempt. Then the block is dropped.
+// A retry waiting on shutdown is left for the spool. It must be called from the result loop,
+// whose submitLoops count keeps the wait group from being waited on meanwhile.
+func (m *Manager) retryOffline(bundle *minedResult, firstTried map[common.Hash]time.Time) {
+	hash := bundle.Header.Hash()
+	first, ok := firstTried[hash]
+	if !ok {
+		first = time.Now()
+		firstTried[hash] = first
+	}
+	if time.Since(first)+offlineRetryInterval > time.Duration(m.cfg().OfflineSubmitGrace)*time.Second {
+		delete(firstTried, hash)
+		log.Println("At least one of the chains is not online at the moment", "hash", hash)
+		return
+	}
+	log.Println("At least one of the chains is not online at the moment, retrying", "hash", hash, "since", first)
+	m.submitLoops.Add(1)
+	goRecovered("retryOffline", func() {
+		defer m.submitLoops.Done()
+		timer := time.NewTimer(offlineRetryInterval)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			select {
+			case m.resultCh <- bundle:
+				return
+			case <-m.shutdownCh:
+			}
+		case <-m.shutdownCh:
+		}
+		m.withLock(func() { m.unqueued = append(m.unqueued, bundle) })
+	})
+}
+
+// Checks if a connection is still there on orderedBlockClient.chainAvailable
+// A chain that never connected has no client and counts as offline, as does one that is not configured.
+func checkConnection(c chainState) bool {
+	if c.client == nil {
+		return false
+	}
+	_, err := c.client.HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		log.Println("Error: connection lost", "url", c.redactedURL())
+		log.Println(err)
+		return false
+	} else {
+		return true
+	}
 }
 
 // Checks for best location to mine every 10 minutes;
 // if better location is found it will initiate the change to the config.
-func (m *Manager) checkBestLocation(timer int) {
+// With warmStart the first scan runs right away, see warmStartScan.
+func (m *Manager) checkBestLocation(timer int, warmStart bool) {
 	ticker := time.NewTicker(time.Duration(timer) * time.Minute)
-	go func() {
+	check := func() {
+		// stay at the current location for at least one timer interval after a switch
+		if time.Since(m.lastSwitch) < time.Duration(timer)*time.Minute {
+			return
+		}
+		options := m.fleet.withPeers(newOptimizerOptions(*m.cfg()))
+		options.gasUsed = m.gasUsed
+		options.currentRegion = int(m.location[0])
+		newLocation, err := findBestLocation(m.chainStates(), options)
+		if err != nil {
+			log.Println("Keeping current location", "location", m.location, "err", err)
+			return
+		}
+		// check if location has changed, and if true, update mining processes
+		if !bytes.Equal(newLocation, m.location) {
+			m.switchLocation(newLocation)
+			persistOptimizerState(m.cfg().OptimizerStateFile, newLocation, m.lastSwitch)
+		}
+	}
+	safeGo("checkBestLocation", func() {
+		if warmStart {
+			m.warmStartScan()
+		}
 		for {
 			select {
 			case <-exit:
 				ticker.Stop()
 				return
 			case <-ticker.C:
-				newLocation := findBestLocation(m.orderedBlockClients)
-				// check if location has changed, and if true, update mining processes
-				if !bytes.Equal(newLocation, m.location) {
-					m.doneCh <- true // channel to make current processes stop
-					m.location = newLocation
-					m.doneCh <- false // set back to false to let new mining processes start
-					m.subscribeAllPendingBlocks()
-					m.fetchAllPendingBlocks()
-				}
+				check()
+			case <-m.difficultyWatch.Recheck():
+				check()
+			case timer = <-m.optimizeTimerCh:
+				ticker.Reset(time.Duration(timer) * time.Minute)
+				log.Println("Optimizer timer updated", "minutes", timer)
 			}
 		}
-	}()
+	})
+}
+
+// switchLocation stops the pending block subscriptions of the current location and starts
+// mining the new one.
+func (m *Manager) switchLocation(newLocation []byte) {
+	m.withLock(func() {
+		close(m.doneCh) // make the current subscriptions stop
+		m.location = newLocation
+		m.lastPendingKeys = [3]pendingBlockKey{}
+		// the templates of the old location don't hold the combined header time up
+		m.pendingTimes = [3]uint64{}
+	})
+	m.lastSwitch = time.Now()
+	m.fleet.register(newLocation)
+	m.subscribeAllPendingBlocks()
+	m.fetchAllPendingBlocks()
 }
 
 // Bundle of goroutines that need to be stopped and restarted if/when location updates.
 func (m *Manager) subscribeAllPendingBlocks() {
+	done := make(chan struct{})
+	m.withLock(func() { m.doneCh = done })
+
 	// subscribing to the pending blocks
-	if m.orderedBlockClients.primeAvailable && checkConnection(m.orderedBlockClients.primeClient) {
-		go m.subscribePendingHeader(m.orderedBlockClients.primeClient, 0)
+	for sliceIndex, c := range m.activeSlice().chains {
+		if state := m.chainState(c); state.available && checkConnection(state) {
+			// the nodes of a new location build for their own etherbase until switched
+			m.requestCoinbase(sliceIndex, c)
+			client, sliceIndex := state.client, sliceIndex
+			var subscriptionDone <-chan struct{} = done
+			if sliceIndex == 0 {
+				m.withLock(func() { subscriptionDone = m.primeSubscriptionDone(done) })
+			}
+			safeGo("subscribePendingHeader "+contextNames[sliceIndex], func() { m.subscribePendingHeader(client, sliceIndex, subscriptionDone) })
+		}
 	}
-	if m.orderedBlockClients.regionsAvailable[m.location[0]-1] && checkConnection(m.orderedBlockClients.regionClients[m.location[0]-1]) {
-		go m.subscribePendingHeader(m.orderedBlockClients.regionClients[m.location[0]-1], 1)
+}
+
+// mergeInitialPendingBlocks fetches the pending blocks of the mining slice and merges them into
+// the combined header directly. It must run before loopGlobalBlock starts, pending blocks of
+// updates that arrive meanwhile wait in their channels and are merged afterwards. It waits at
+// most InitialFetchTimeout seconds, blocks fetched later are merged by loopGlobalBlock.
+func (m *Manager) mergeInitialPendingBlocks() {
+	clients := m.activeSlice().chains
+	// fetch the contexts concurrently, each retries on its own until its node serves a block
+	results := make([]chan *pendingBlock, len(clients))
+	for sliceIndex, c := range clients {
+		state := m.chainState(c)
+		if !state.available || !checkConnection(state) {
+			continue
+		}
+		result := make(chan *pendingBlock, 1)
+		results[sliceIndex] = result
+		client, sliceIndex := state.client, sliceIndex
+		safeGo(fmt.Sprint("fetchPendingBlock initial ", contextNames[sliceIndex]), func() { result <- m.fetchPendingBlock(client, sliceIndex) })
 	}
-	if m.orderedBlockClients.zonesAvailable[m.location[0]-1][m.location[1]-1] && checkConnection(m.orderedBlockClients.zoneClients[m.location[0]-1][m.location[1]-1]) {
-		go m.subscribePendingHeader(m.orderedBlockClients.zoneClients[m.location[0]-1][m.location[1]-1], 2)
+
+	ctx := context.Background()
+	if timeout := time.Duration(m.cfg().InitialFetchTimeout) * time.Second; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	for sliceIndex, result := range results {
+		if result == nil {
+			continue
+		}
+		select {
+		case pending := <-result:
+			if pending != nil {
+				m.handlePendingBlock(pending, sliceIndex)
+			}
+		case <-ctx.Done():
+			// merge the block like any update once it arrives
+			log.Println("Initial pending block fetch timed out, starting without it", "context", contextNames[sliceIndex], "timeout", m.cfg().InitialFetchTimeout)
+			result, sliceIndex := result, sliceIndex
+			safeGo(fmt.Sprint("fetchPendingBlock late ", contextNames[sliceIndex]), func() {
+				if pending := <-result; pending != nil {
+					m.enqueuePendingBlock(pending, sliceIndex)
+				}
+			})
+		}
 	}
 }
 
 // Bundle of goroutines that need to be stopped and restarted if/when location updates.
 func (m *Manager) fetchAllPendingBlocks() {
-	if m.orderedBlockClients.primeAvailable && checkConnection(m.orderedBlockClients.primeClient) {
-		go m.fetchPendingBlocks(m.orderedBlockClients.primeClient, 0)
-	}
-	if m.orderedBlockClients.regionsAvailable[m.location[0]-1] && checkConnection(m.orderedBlockClients.regionClients[m.location[0]-1]) {
-		go m.fetchPendingBlocks(m.orderedBlockClients.regionClients[m.location[0]-1], 1)
-	}
-	if m.orderedBlockClients.zonesAvailable[m.location[0]-1][m.location[1]-1] && checkConnection(m.orderedBlockClients.zoneClients[m.location[0]-1][m.location[1]-1]) {
-		go m.fetchPendingBlocks(m.orderedBlockClients.zoneClients[m.location[0]-1][m.location[1]-1], 2)
+	for sliceIndex, c := range m.activeSlice().chains {
+		if state := m.chainState(c); state.available && checkConnection(state) {
+			client, sliceIndex := state.client, sliceIndex
+			safeGo("fetchPendingBlocks "+contextNames[sliceIndex], func() { m.fetchPendingBlocks(client, sliceIndex) })
+		}
 	}
 }
@@ -0,0 +1,770 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spruce-solutions/go-quai/common"
+	"github.com/spruce-solutions/go-quai/core/types"
+	"github.com/spruce-solutions/go-quai/rpc"
+	"github.com/spruce-solutions/quai-manager/manager/util"
+)
+
+// newTestManager returns a manager mining the location with the engine and no nodes, with
+// region and zone headers so that the mining loop starts sealing.
+func newTestManager(engine powEngine, location []byte) *Manager {
+	combined := types.NewEmptyHeader()
+	combined.Number[1] = big.NewInt(1)
+	combined.Number[2] = big.NewInt(1)
+	receiptCache, err := newReceiptCache(16, time.Minute, newMemoryBudget(0))
+	if err != nil {
+		panic(err)
+	}
+	m := &Manager{
+		engine:               engine,
+		orderedBlockClients:  newTestClients(),
+		combinedHeader:       combined,
+		pendingBlocks:        make([]*types.ReceiptBlock, len(contextNames)),
+		pendingPrimeBlockCh:  make(chan *pendingBlock, resultQueueSize),
+		pendingRegionBlockCh: make(chan *pendingBlock, resultQueueSize),
+		pendingZoneBlockCh:   make(chan *pendingBlock, resultQueueSize),
+		resultCh:             make(chan *minedResult, resultQueueSize),
+		submitChs:            newSubmitChannels(),
+		submissions:          newSubmissionCancels(),
+		updatedCh:            make(chan *types.Header, resultQueueSize),
+		shutdownCh:           make(chan struct{}),
+		doneCh:               make(chan struct{}),
+		location:             append([]byte{}, location...),
+		receiptCache:         receiptCache,
+		mineContexts:         newContextFlags(true, true, true),
+		acceptance:           newAcceptanceTracker(0, ""),
+		gasUsed:              newGasTracker(),
+		externalSends:        newExternalSends(0),
+		minedSubmissions:     newSubmissionStats(),
+		externalSubmissions:  newSubmissionStats(),
+		minedGaps:            newMinedGaps(),
+		syncLags:             newSyncLags(),
+	}
+	m.config.Store(&util.Config{})
+	return m
+}
+
+// newTestClients returns the clients of three regions of three zones that never connected.
+func newTestClients() orderedBlockClients {
+	clients := orderedBlockClients{prime: &blockClient{}}
+	for i := 0; i < 3; i++ {
+		clients.regions = append(clients.regions, &blockClient{})
+		zones := make([]*blockClient, 3)
+		for j := range zones {
+			zones[j] = &blockClient{}
+		}
+		clients.zones = append(clients.zones, zones)
+	}
+	return clients
+}
+
+// newTestPendingBlock returns a pending block of the context at the number, fetched for the
+// location.
+func newTestPendingBlock(sliceIndex int, number int64, location []byte) *pendingBlock {
+	header := types.NewEmptyHeader()
+	header.Number[sliceIndex] = big.NewInt(number)
+	header.ParentHash[sliceIndex] = common.BigToHash(big.NewInt(number - 1))
+	header.Difficulty[sliceIndex] = big.NewInt(1000)
+	header.Location = append([]byte{}, location...)
+	return &pendingBlock{block: types.NewReceiptBlockWithHeader(header), location: append([]byte{}, location...)}
+}
+
+// newTestHead returns a header of every context at the number.
+func newTestHead(number int64) *types.Header {
+	header := types.NewEmptyHeader()
+	for i := range contextNames {
+		header.Number[i] = big.NewInt(number)
+		header.Difficulty[i] = big.NewInt(1000)
+		header.NetworkDifficulty[i] = big.NewInt(1000)
+		header.BaseFee[i] = big.NewInt(1)
+	}
+	header.Location = []byte{0, 0}
+	return header
+}
+
+// nextResult returns the next result the mining loop passed on.
+func nextResult(t *testing.T, m *Manager) *minedResult {
+	t.Helper()
+	select {
+	case result := <-m.resultCh:
+		return result
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mined result")
+		return nil
+	}
+}
+
+func TestMinedResultKeepsWorkOfSwitchDuringSeal(t *testing.T) {
+	engine := newFakeEngine()
+	m := newTestManager(engine, []byte{0, 0})
+	// keep the first seal running through the switch
+	config := *m.cfg()
+	config.MinSealDuration = int(time.Hour / time.Millisecond)
+	m.config.Store(&config)
+	go m.miningLoop()
+
+	before := newTestPendingBlock(2, 10, []byte{0, 0})
+	m.handlePendingBlock(before, 2)
+	seal := engine.next(t)
+
+	// the optimizer switches to another zone while the header is sealed
+	m.withLock(func() { m.location = []byte{1, 1} })
+	after := newTestPendingBlock(2, 20, []byte{1, 1})
+	m.handlePendingBlock(after, 2)
+
+	seal.solve(7, 2)
+	result := nextResult(t, m)
+	if result.pending[2] != before.block {
+		t.Errorf("result carries pending block %v, want the one sealed %v", result.pending[2].Header().Number, before.block.Header().Number)
+	}
+	if !bytes.Equal(result.location, []byte{0, 0}) {
+		t.Errorf("result carries location %v, want the sealed location [0 0]", result.location)
+	}
+	if got, want := result.Header.ParentHash[2], before.block.Header().ParentHash[2]; got != want {
+		t.Errorf("sealed header has parent %v, want %v of the sealed pending block", got, want)
+	}
+	if got := result.Header.Number[2]; got.Cmp(big.NewInt(10)) != 0 {
+		t.Errorf("sealed header has number %v, want 10", got)
+	}
+}
+
+// fillContext sets the entry of the context in every per-context field of the header to a value
+// derived from seed.
+func fillContext(t *testing.T, header *types.Header, sliceIndex int, seed byte) {
+	t.Helper()
+	value := reflect.ValueOf(header).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field, name := value.Field(i), value.Type().Field(i).Name
+		if field.Kind() != reflect.Slice || name == "Location" {
+			continue
+		}
+		if field.Len() <= sliceIndex {
+			t.Fatalf("header field %s has no entry for context %d", name, sliceIndex)
+		}
+		entry := field.Index(sliceIndex)
+		switch entry.Kind() {
+		case reflect.Array:
+			for j := 0; j < entry.Len(); j++ {
+				entry.Index(j).SetUint(uint64(seed))
+			}
+		case reflect.Uint64:
+			entry.SetUint(uint64(seed))
+		case reflect.Slice:
+			entry.SetBytes([]byte{seed})
+		case reflect.Ptr:
+			entry.Set(reflect.ValueOf(big.NewInt(int64(seed))))
+		default:
+			t.Fatalf("header field %s has entries of unhandled kind %v", name, entry.Kind())
+		}
+	}
+}
+
+func TestUpdateCombinedHeaderMergesEveryContextField(t *testing.T) {
+	for sliceIndex := range contextNames {
+		t.Run(contextNames[sliceIndex], func(t *testing.T) {
+			m := newTestManager(newFakeEngine(), []byte{1, 2})
+			m.combinedHeader = types.NewEmptyHeader()
+			for i := range contextNames {
+				fillContext(t, m.combinedHeader, i, 0xee)
+			}
+			source := types.NewEmptyHeader()
+			fillContext(t, source, sliceIndex, byte(sliceIndex+1))
+			source.Time = 1234
+			// the entries of the other contexts of the source are not merged
+			for i := range contextNames {
+				if i != sliceIndex {
+					fillContext(t, source, i, 0xdd)
+				}
+			}
+
+			m.updateCombinedHeader(source, sliceIndex)
+
+			// the other contexts keep their entries
+			expected := types.NewEmptyHeader()
+			for i := range contextNames {
+				fillContext(t, expected, i, 0xee)
+			}
+			fillContext(t, expected, sliceIndex, byte(sliceIndex+1))
+			combined, want := reflect.ValueOf(m.combinedHeader).Elem(), reflect.ValueOf(expected).Elem()
+			for i := 0; i < combined.NumField(); i++ {
+				name := combined.Type().Field(i).Name
+				if combined.Field(i).Kind() != reflect.Slice || name == "Location" {
+					continue
+				}
+				if got, want := combined.Field(i).Interface(), want.Field(i).Interface(); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s is %v after merging context %d, want %v", name, got, sliceIndex, want)
+				}
+			}
+			if m.combinedHeader.Time != 1234 {
+				t.Errorf("Time is %d, want the time of the merged header", m.combinedHeader.Time)
+			}
+			if !bytes.Equal(m.combinedHeader.Location, []byte{1, 2}) {
+				t.Errorf("Location is %v, want the mined location [1 2]", m.combinedHeader.Location)
+			}
+		})
+	}
+}
+
+func TestBackoffDelaySecs(t *testing.T) {
+	previous := int64(-1)
+	for attempts := 0; attempts <= 70; attempts++ {
+		want := exponentialBackoffCeilingSecs
+		if attempts < 62 {
+			if delay := (int64(1)<<uint(attempts) - 1) / 2; delay < want {
+				want = delay
+			}
+		}
+		got := backoffDelaySecs(attempts)
+		if got != want {
+			t.Errorf("backoffDelaySecs(%d) = %d, want %d", attempts, got, want)
+		}
+		if got < previous {
+			t.Errorf("backoffDelaySecs(%d) = %d is below the delay %d of the attempt before", attempts, got, previous)
+		}
+		previous = got
+	}
+	if got := backoffDelaySecs(20); got != exponentialBackoffCeilingSecs {
+		t.Errorf("backoffDelaySecs(20) = %d, want the ceiling %d", got, exponentialBackoffCeilingSecs)
+	}
+	// 2^attempts overflows to +Inf as a float
+	for _, attempts := range []int{1024, 1100, 1 << 20} {
+		if got := backoffDelaySecs(attempts); got != exponentialBackoffCeilingSecs {
+			t.Errorf("backoffDelaySecs(%d) = %d, want the ceiling %d", attempts, got, exponentialBackoffCeilingSecs)
+		}
+	}
+	for _, attempts := range []int{-1, -64, -2000} {
+		if got := backoffDelaySecs(attempts); got != 0 {
+			t.Errorf("backoffDelaySecs(%d) = %d, want 0", attempts, got)
+		}
+	}
+	if got := cappedBackoffDelaySecs(10, 30); got != 30 {
+		t.Errorf("cappedBackoffDelaySecs(10, 30) = %d, want 30", got)
+	}
+}
+
+// testNode is an in-process node. Its "quai" service serves the latest header and the pending
+// block template and records the blocks sent to it, every call fails while the node is down.
+type testNode struct {
+	lock                 sync.Mutex
+	head                 *types.Header
+	pending              *types.Header // template served as the pending block
+	down                 bool
+	mined                []common.Hash       // mined blocks submitted to the node
+	external             []testExternalBlock // external blocks relayed to the node
+	pendingSubscriptions int32               // pending block subscriptions open, accessed atomically
+	pendingRequests      int32               // pending blocks served, accessed atomically
+}
+
+// testExternalBlock is an external block received by a testNode.
+type testExternalBlock struct {
+	Hash    common.Hash `json:"hash"`
+	Context *big.Int    `json:"context"`
+}
+
+func (n *testNode) call() error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.down {
+		return errors.New("node down")
+	}
+	return nil
+}
+
+func (n *testNode) GetBlockByNumber(number rpc.BlockNumber, fullTx bool) (*types.Header, error) {
+	if err := n.call(); err != nil {
+		return nil, err
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.head, nil
+}
+
+func (n *testNode) Syncing() (bool, error) {
+	return false, n.call()
+}
+
+func (n *testNode) PendingBlock() (*types.Header, error) {
+	if err := n.call(); err != nil {
+		return nil, err
+	}
+	atomic.AddInt32(&n.pendingRequests, 1)
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.pending, nil
+}
+
+func (n *testNode) SendMinedBlock(block json.RawMessage) error {
+	if err := n.call(); err != nil {
+		return err
+	}
+	var sent testExternalBlock
+	if err := json.Unmarshal(block, &sent); err != nil {
+		return err
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.mined = append(n.mined, sent.Hash)
+	return nil
+}
+
+func (n *testNode) SendExternalBlock(block json.RawMessage) error {
+	if err := n.call(); err != nil {
+		return err
+	}
+	var sent testExternalBlock
+	if err := json.Unmarshal(block, &sent); err != nil {
+		return err
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.external = append(n.external, sent)
+	return nil
+}
+
+// minedBlocks returns the hashes of the mined blocks submitted to the node.
+func (n *testNode) minedBlocks() []common.Hash {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return append([]common.Hash{}, n.mined...)
+}
+
+// externalBlocks returns the external blocks relayed to the node.
+func (n *testNode) externalBlocks() []testExternalBlock {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return append([]testExternalBlock{}, n.external...)
+}
+
+// testNodeSubscriptions is the "eth" subscription service of a testNode.
+type testNodeSubscriptions struct {
+	node *testNode
+}
+
+// PendingBlock opens a pending block subscription that never notifies and counts it until the
+// client unsubscribes.
+func (s testNodeSubscriptions) PendingBlock(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, ok := rpc.NotifierFromContext(ctx)
+	if !ok {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	sub := notifier.CreateSubscription()
+	atomic.AddInt32(&s.node.pendingSubscriptions, 1)
+	go func() {
+		<-sub.Err()
+		atomic.AddInt32(&s.node.pendingSubscriptions, -1)
+	}()
+	return sub, nil
+}
+
+// NewHeads opens a new head subscription that never notifies.
+func (s testNodeSubscriptions) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	return idleSubscription(ctx)
+}
+
+// MissingExtBlock opens a missing external block subscription that never notifies.
+func (s testNodeSubscriptions) MissingExtBlock(ctx context.Context) (*rpc.Subscription, error) {
+	return idleSubscription(ctx)
+}
+
+func idleSubscription(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, ok := rpc.NotifierFromContext(ctx)
+	if !ok {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	return notifier.CreateSubscription(), nil
+}
+
+// newTestClient returns a client connected to an in-process node serving the head, or failing
+// every call if down.
+func newTestClient(t *testing.T, head *types.Header, down bool) (*blockClient, *testNode) {
+	t.Helper()
+	node := &testNode{head: head, down: down}
+	server := rpc.NewServer()
+	if err := server.RegisterName("quai", node); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegisterName("eth", testNodeSubscriptions{node}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Stop)
+	c := &blockClient{url: "inproc://test"}
+	c.connect(rpc.DialInProc(server))
+	c.available = true
+	return c, node
+}
+
+// testNetwork is an in-process node for prime and every region and zone of three regions of
+// three zones.
+type testNetwork struct {
+	clients orderedBlockClients
+	nodes   map[[2]byte]*testNode
+}
+
+// newTestNetwork starts the nodes of the network. Every node serves a head and a pending block
+// template of its own location.
+func newTestNetwork(t *testing.T) *testNetwork {
+	t.Helper()
+	network := &testNetwork{nodes: make(map[[2]byte]*testNode)}
+	connect := func(location []byte) *blockClient {
+		head := newTestHead(1)
+		head.Location = location
+		c, node := newTestClient(t, head, false)
+		node.pending = newTestTemplate(location)
+		network.nodes[[2]byte{location[0], location[1]}] = node
+		return c
+	}
+	network.clients.prime = connect([]byte{0, 0})
+	for i := byte(1); i <= 3; i++ {
+		network.clients.regions = append(network.clients.regions, connect([]byte{i, 0}))
+		var zones []*blockClient
+		for j := byte(1); j <= 3; j++ {
+			zones = append(zones, connect([]byte{i, j}))
+		}
+		network.clients.zones = append(network.clients.zones, zones)
+	}
+	return network
+}
+
+// attach connects the manager that subscribes to the pending blocks of the network. Once the
+// test ends, the subscriptions of the manager are stopped before the nodes are, a subscription
+// that fails because its node is gone ends the process.
+func (n *testNetwork) attach(t *testing.T, m *Manager) {
+	m.orderedBlockClients = n.clients
+	t.Cleanup(func() {
+		eventually(t, "the subscriptions of the last location", func() bool { return n.subscriptionsAt(m, m.currentLocation()) })
+		m.withLock(func() { close(m.doneCh) })
+		eventually(t, "the subscriptions to stop", func() bool {
+			for _, node := range n.nodes {
+				if atomic.LoadInt32(&node.pendingSubscriptions) != 0 {
+					return false
+				}
+			}
+			return true
+		})
+	})
+}
+
+// node returns the node of the chain at the location.
+func (n *testNetwork) node(location ...byte) *testNode {
+	return n.nodes[[2]byte{location[0], location[1]}]
+}
+
+// newTestTemplate returns a pending block template of every context for a node at the location.
+func newTestTemplate(location []byte) *types.Header {
+	header := newTestHead(2)
+	header.Location = append([]byte{}, location...)
+	for i := range contextNames {
+		header.UncleHash[i] = types.EmptyUncleHash[i]
+		header.TxHash[i] = types.EmptyRootHash[i]
+		header.ReceiptHash[i] = types.EmptyRootHash[i]
+	}
+	return header
+}
+
+func TestCheckConnection(t *testing.T) {
+	online, _ := newTestClient(t, newTestHead(1), false)
+	offline, _ := newTestClient(t, newTestHead(1), true)
+	tests := []struct {
+		name   string
+		client *blockClient
+		want   bool
+	}{
+		{"not configured", nil, false},
+		{"never connected", &blockClient{}, false},
+		{"online", online, true},
+		{"erroring", offline, false},
+	}
+	for _, test := range tests {
+		if got := checkConnection(test.client.state()); got != test.want {
+			t.Errorf("checkConnection of a %s client = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAllChainsOnline(t *testing.T) {
+	online, _ := newTestClient(t, newTestHead(1), false)
+	offline, _ := newTestClient(t, newTestHead(1), true)
+	clients := map[string]*blockClient{"nil": nil, "unconnected": {}, "online": online, "erroring": offline}
+	// a chain counts as offline only if it is connected and erroring, or if it is prime and
+	// prime is mined without a connected client
+	for primeName, prime := range clients {
+		for regionName, region := range clients {
+			for zoneName, zone := range clients {
+				for _, hasPrime := range []bool{true, false} {
+					m := newTestManager(newFakeEngine(), []byte{0, 0})
+					config := *m.cfg()
+					config.HasPrime = hasPrime
+					m.config.Store(&config)
+					m.orderedBlockClients = orderedBlockClients{
+						prime:   prime,
+						regions: []*blockClient{region, online, nil},
+						zones:   [][]*blockClient{{zone, nil, online}, {online, online, online}, nil},
+					}
+					want := regionName != "erroring" && zoneName != "erroring"
+					if hasPrime {
+						want = want && primeName == "online"
+					}
+					if got := m.allChainsOnline(); got != want {
+						t.Errorf("allChainsOnline with %s prime (HasPrime %v), %s region and %s zone = %v, want %v", primeName, hasPrime, regionName, zoneName, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+// mergeTime merges a header of the context with the time into the combined header.
+func mergeTime(m *Manager, sliceIndex int, time uint64) {
+	header := newTestHead(1)
+	header.Time = time
+	m.updateCombinedHeader(header, sliceIndex)
+}
+
+func TestCombinedHeaderTimeOutOfOrder(t *testing.T) {
+	type update struct {
+		sliceIndex int
+		time       uint64
+	}
+	tests := []struct {
+		name    string
+		updates []update
+		want    uint64
+	}{
+		{"in order", []update{{0, 100}, {1, 110}, {2, 120}}, 120},
+		{"older context after newer", []update{{2, 200}, {1, 100}}, 200},
+		{"older prime after newer zone", []update{{2, 200}, {0, 50}}, 200},
+		{"context template moves back", []update{{2, 200}, {1, 150}, {2, 120}}, 150},
+		{"every context moves back", []update{{0, 300}, {1, 300}, {2, 300}, {0, 90}, {1, 80}, {2, 70}}, 90},
+		{"same context repeated", []update{{2, 100}, {2, 100}, {2, 100}}, 100},
+	}
+	for _, test := range tests {
+		m := newTestManager(newFakeEngine(), []byte{1, 1})
+		for _, update := range test.updates {
+			mergeTime(m, update.sliceIndex, update.time)
+		}
+		// the time is the latest of the latest template of every context
+		if got := m.combinedHeader.Time; got != test.want {
+			t.Errorf("%s: combined header time is %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSwitchLocationClearsPendingTimes(t *testing.T) {
+	m := newTestManager(newFakeEngine(), []byte{1, 1})
+	mergeTime(m, 0, 100)
+	mergeTime(m, 1, 100)
+	mergeTime(m, 2, 900)
+
+	m.switchLocation([]byte{2, 2})
+	if m.pendingTimes != [3]uint64{} {
+		t.Fatalf("pending times are %v after the switch, want them cleared", m.pendingTimes)
+	}
+	// the zone template of the old location no longer holds the time up
+	mergeTime(m, 2, 200)
+	if got := m.combinedHeader.Time; got != 200 {
+		t.Errorf("combined header time is %d after the switch, want 200 of the new zone", got)
+	}
+}
+
+// eventually fails the test unless cond holds within five seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// subscriptionsAt reports whether the chains of the slice mined at the location have one
+// pending block subscription open each and all other chains none.
+func (n *testNetwork) subscriptionsAt(m *Manager, location []byte) bool {
+	mined := make(map[[2]byte]bool)
+	for _, chain := range m.sliceAt(location).locations {
+		mined[[2]byte{chain[0], chain[1]}] = true
+	}
+	for chain, node := range n.nodes {
+		want := int32(0)
+		if mined[chain] {
+			want = 1
+		}
+		if atomic.LoadInt32(&node.pendingSubscriptions) != want {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSwitchLocationStopsOldSubscriptions(t *testing.T) {
+	network := newTestNetwork(t)
+	m := newTestManager(newFakeEngine(), []byte{1, 1})
+	network.attach(t, m)
+	go m.loopGlobalBlock()
+
+	m.subscribeAllPendingBlocks()
+	m.fetchAllPendingBlocks()
+	eventually(t, "the subscriptions of [1 1]", func() bool { return network.subscriptionsAt(m, []byte{1, 1}) })
+	eventually(t, "the pending blocks of [1 1]", func() bool {
+		var merged bool
+		m.withLock(func() { merged = m.pendingBlocks[2] != nil })
+		return merged
+	})
+	time.Sleep(100 * time.Millisecond)
+	baseline := runtime.NumGoroutine()
+
+	locations := [][]byte{{2, 2}, {3, 1}, {1, 3}, {2, 1}, {1, 1}}
+	for i := 0; i < 40; i++ {
+		m.switchLocation(locations[i%len(locations)])
+	}
+	last := locations[(40-1)%len(locations)]
+	eventually(t, fmt.Sprintf("only the subscriptions of %v", last), func() bool { return network.subscriptionsAt(m, last) })
+	// the subscribers, fetches and their RPC goroutines of the old locations all ended
+	eventually(t, fmt.Sprintf("the goroutines to return to %d", baseline), func() bool { return runtime.NumGoroutine() <= baseline })
+}
+
+// externalBlocks returns the external blocks relayed to every node of the network.
+func (n *testNetwork) externalBlocks() map[[2]byte][]testExternalBlock {
+	relayed := make(map[[2]byte][]testExternalBlock)
+	for chain, node := range n.nodes {
+		if blocks := node.externalBlocks(); len(blocks) > 0 {
+			relayed[chain] = blocks
+		}
+	}
+	return relayed
+}
+
+func TestSendClientsExtBlockChecksContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		order    int  // context the seal meets
+		noNumber bool // whether the region number is missing
+		relayed  bool
+	}{
+		{"matching context", 1, false, true},
+		{"seal stronger than the context", 0, false, true},
+		{"seal only meets zone", 2, false, false},
+		{"no region number", 1, true, false},
+	}
+	for _, test := range tests {
+		network := newTestNetwork(t)
+		engine := newFakeEngine()
+		engine.order = test.order
+		m := newTestManager(engine, []byte{1, 1})
+		// nothing is subscribed, the nodes can stop right away
+		m.orderedBlockClients = network.clients
+
+		header := newTestTemplate([]byte{1, 1})
+		if test.noNumber {
+			header.Number[1] = nil
+		}
+		block := types.NewBlockWithHeader(header)
+		m.SendClientsExtBlock(context.Background(), 1, []int{0, 2}, block, types.NewReceiptBlockWithHeader(header))
+
+		relayed := network.externalBlocks()
+		if !test.relayed {
+			if len(relayed) > 0 {
+				t.Errorf("%s: relayed the region block to %d chains, want none", test.name, len(relayed))
+			}
+			continue
+		}
+		// every chain but the region it was mined in gets the region block
+		if len(relayed) != len(network.nodes)-1 || relayed[[2]byte{1, 0}] != nil {
+			t.Errorf("%s: relayed the region block to %d chains, want all %d but region 1", test.name, len(relayed), len(network.nodes)-1)
+		}
+		for chain, blocks := range relayed {
+			if len(blocks) != 1 || blocks[0].Hash != block.Hash() || blocks[0].Context.Int64() != 1 {
+				t.Errorf("%s: chain %v received %v, want the region block once with context 1", test.name, chain, blocks)
+			}
+		}
+	}
+}
+
+func TestSendMinedBlockDuringSwitch(t *testing.T) {
+	network := newTestNetwork(t)
+	m := newTestManager(newFakeEngine(), []byte{1, 1})
+	network.attach(t, m)
+	go m.loopGlobalBlock()
+
+	// the optimizer keeps switching while the blocks sealed for [1 1] are sent
+	stop := make(chan struct{})
+	switched := make(chan struct{})
+	go func() {
+		defer close(switched)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			m.switchLocation([][]byte{{2, 2}, {3, 3}, {1, 1}}[i%3])
+		}
+	}()
+
+	var sent []common.Hash
+	for i := 0; i < 20; i++ {
+		template := newTestTemplate([]byte{1, 1})
+		template.Number[2] = big.NewInt(int64(10 + i))
+		pending := make([]*types.ReceiptBlock, len(contextNames))
+		pending[2] = types.NewReceiptBlockWithHeader(template)
+		header := types.NewBlockWithHeader(template).Header()
+		header.Nonce = types.EncodeNonce(uint64(i))
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		m.SendMinedBlock(context.Background(), 2, header, pending, []byte{1, 1}, &wg)
+		sent = append(sent, header.Hash())
+	}
+	close(stop)
+	<-switched
+
+	if got := network.node(1, 1).minedBlocks(); !reflect.DeepEqual(got, sent) {
+		t.Errorf("zone [1 1] received %d of the %d mined blocks sealed for it", len(got), len(sent))
+	}
+	for _, location := range [][]byte{{2, 2}, {3, 3}} {
+		if got := network.node(location...).minedBlocks(); len(got) > 0 {
+			t.Errorf("zone %v received %d mined blocks sealed for [1 1]", location, len(got))
+		}
+	}
+}
+
+func TestSendSealedBlockSkipsUnavailableChains(t *testing.T) {
+	m := newTestManager(newFakeEngine(), []byte{1, 1})
+	network := newTestNetwork(t)
+	m.orderedBlockClients = network.clients
+	network.clients.regions[0].available = false
+	network.clients.zones[1][1] = nil
+
+	sealed := func(location []byte) *types.ExternalBlock {
+		return types.NewExternalBlockWithHeader(newTestTemplate(location))
+	}
+	m.sendSealedBlock(sealed([]byte{1, 1}), 1)
+	m.sendSealedBlock(sealed([]byte{2, 2}), 2)
+	m.sendSealedBlock(sealed([]byte{4, 1}), 2)
+	if got := network.node(1, 0).minedBlocks(); len(got) > 0 {
+		t.Errorf("unavailable region 1 received %d sealed blocks", len(got))
+	}
+
+	block := sealed([]byte{3, 2})
+	m.sendSealedBlock(block, 2)
+	want := []common.Hash{types.NewBlockWithHeader(block.Header()).Hash()}
+	if got := network.node(3, 2).minedBlocks(); !reflect.DeepEqual(got, want) {
+		t.Errorf("zone [3 2] received sealed blocks %v, want %v", got, want)
+	}
+}
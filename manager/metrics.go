@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spruce-solutions/go-quai/metrics"
+)
+
+// contextNames maps a difficulty context to the name used in logs and metric tags.
+var contextNames = []string{"prime", "region", "zone"}
+
+var (
+	// droppedUpdatesCounters count combined header updates that were dropped because the miner
+	// had not consumed the previous one yet, indexed by context.
+	droppedUpdatesCounters = newContextCounters("manager/miner/dropped")
+
+	// relayedExternalCounters count external blocks relayed proactively to each target chain.
+	relayedExternalCounters = newChainCounters("manager/relay/external")
+	// missingExternalCounters count external blocks sent to each target chain that reported
+	// them missing.
+	missingExternalCounters = newChainCounters("manager/relay/missing")
+
+	// minedBlocksCounters, minedTxsCounters and minedUnclesCounters count the mined blocks and
+	// the transactions and uncles they carried, indexed by context, for the average fullness.
+	minedBlocksCounters = newContextCounters("manager/mined/blocks")
+	minedTxsCounters    = newContextCounters("manager/mined/txs")
+	minedUnclesCounters = newContextCounters("manager/mined/uncles")
+)
+
+// newContextCounters registers one counter per difficulty context under the given prefix.
+func newContextCounters(prefix string) []metrics.Counter {
+	counters := make([]metrics.Counter, len(contextNames))
+	for i, name := range contextNames {
+		counters[i] = metrics.NewRegisteredCounterForced(prefix+"/"+name, nil)
+	}
+	return counters
+}
+
+// newGaugeForced registers a gauge under the name that is updated even if metrics collection
+// is not enabled, like the forced counters.
+func newGaugeForced(name string) metrics.Gauge {
+	gauge := new(metrics.StandardGauge)
+	metrics.DefaultRegistry.Register(name, gauge)
+	return gauge
+}
+
+// chainName names the chain at the location in metric names, e.g. prime, region1 or zone1_2.
+func chainName(location [2]byte) string {
+	switch {
+	case location[0] == 0:
+		return "prime"
+	case location[1] == 0:
+		return fmt.Sprintf("region%d", location[0])
+	default:
+		return fmt.Sprintf("zone%d_%d", location[0], location[1])
+	}
+}
+
+// newChainCounters registers one counter per chain of the largest known ontology under the
+// given prefix, keyed by chain location.
+func newChainCounters(prefix string) map[[2]byte]metrics.Counter {
+	counters := make(map[[2]byte]metrics.Counter)
+	numRegions, numZones := maxOntology()
+	for region := 0; region <= numRegions; region++ {
+		for zone := 0; zone <= numZones; zone++ {
+			if region == 0 && zone != 0 {
+				continue
+			}
+			location := [2]byte{byte(region), byte(zone)}
+			counters[location] = metrics.NewRegisteredCounterForced(prefix+"/"+chainName(location), nil)
+		}
+	}
+	return counters
+}
+
+// incChainCounter increments the counter of the chain at the location, if there is one.
+func incChainCounter(counters map[[2]byte]metrics.Counter, location []byte) {
+	if len(location) < 2 {
+		return
+	}
+	if counter, ok := counters[[2]byte{location[0], location[1]}]; ok {
+		counter.Inc(1)
+	}
+}
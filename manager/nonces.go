@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spruce-solutions/go-quai/common"
+	"github.com/spruce-solutions/go-quai/core/types"
+)
+
+// nonceKey is a seal found by the engine.
+type nonceKey struct {
+	sealHash common.Hash
+	nonce    types.BlockNonce
+}
+
+// nonceRecord is a line of the nonce log file.
+type nonceRecord struct {
+	Time     time.Time        `json:"time"`
+	Context  string           `json:"context"`
+	SealHash common.Hash      `json:"sealHash"`
+	Nonce    types.BlockNonce `json:"nonce"`
+	Reused   bool             `json:"reused"`
+}
+
+// nonceLog logs the nonces of the seals the engine finds and warns when the same nonce is found
+// for the same seal hash again within the window, which points at an engine issue producing
+// duplicate blocks the nodes reject.
+type nonceLog struct {
+	lock   sync.Mutex
+	window time.Duration
+	seen   map[nonceKey]time.Time
+	file   *os.File // appended a JSON line per seal if not nil
+}
+
+// newNonceLog returns a nonce log remembering seals for the window, persisting them to path if it
+// is not empty.
+func newNonceLog(window time.Duration, path string) (*nonceLog, error) {
+	l := &nonceLog{window: window, seen: make(map[nonceKey]time.Time)}
+	if path != "" {
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		l.file = file
+	}
+	return l, nil
+}
+
+// Record logs the nonce of a seal found for the context and reports whether it was found for the
+// same seal hash before within the window.
+func (l *nonceLog) Record(difficultyContext int, sealHash common.Hash, nonce types.BlockNonce) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	for key, seen := range l.seen {
+		if now.Sub(seen) > l.window {
+			delete(l.seen, key)
+		}
+	}
+	key := nonceKey{sealHash: sealHash, nonce: nonce}
+	_, reused := l.seen[key]
+	l.seen[key] = now
+
+	if reused {
+		log.Println("Warning: nonce reused for the same seal hash", "context", contextNames[difficultyContext], "sealHash", sealHash, "nonce", nonce.Uint64(), "window", l.window)
+	} else {
+		log.Println("Seal found", "context", contextNames[difficultyContext], "sealHash", sealHash, "nonce", nonce.Uint64())
+	}
+	if l.file != nil {
+		data, _ := json.Marshal(nonceRecord{Time: now, Context: contextNames[difficultyContext], SealHash: sealHash, Nonce: nonce, Reused: reused})
+		if _, err := l.file.Write(append(data, '\n')); err != nil {
+			log.Println("Failed to write nonce log", "path", l.file.Name(), "err", err)
+		}
+	}
+	return reused
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// readyPollInterval is the delay between checks whether the manager is ready.
+	readyPollInterval = time.Second
+	// miningHeartbeatInterval is how often the mining loop reports that it is running.
+	miningHeartbeatInterval = time.Second
+)
+
+// sdNotify sends the state to the service manager over the socket in $NOTIFY_SOCKET, following
+// the sd_notify protocol. It does nothing if the manager wasn't started by a service manager.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// sdWatchdogInterval returns the watchdog timeout the service manager expects pings within,
+// zero if the watchdog is not enabled for this process.
+func sdWatchdogInterval() (time.Duration, error) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec == "" {
+		return 0, nil
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+	interval, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || interval <= 0 {
+		return 0, errors.New("invalid WATCHDOG_USEC " + usec)
+	}
+	return time.Duration(interval) * time.Microsecond, nil
+}
+
+// ready reports whether all configured chains are connected and, if mining, the pending blocks
+// of the mining slice were fetched.
+func (m *Manager) ready() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !allChainsConnected(m.orderedBlockClients.states(), m.cfg().HasPrime) {
+		return false
+	}
+	if !m.cfg().Mine {
+		return true
+	}
+	for i, pending := range m.pendingBlocks {
+		if pending == nil && (i > 0 || m.cfg().HasPrime) {
+			return false
+		}
+	}
+	return true
+}
+
+// miningHealthy reports whether the mining loop ran within the timeout.
+func (m *Manager) miningHealthy(timeout time.Duration) bool {
+	if !m.cfg().Mine {
+		return true
+	}
+	return time.Since(time.Unix(0, atomic.LoadInt64(&m.miningHeartbeat))) < timeout
+}
+
+// systemdNotify signals READY=1 to systemd once the manager is ready and then sends WATCHDOG=1
+// pings at half the watchdog timeout for as long as the mining loop is running.
+func (m *Manager) systemdNotify() {
+	for !m.ready() {
+		time.Sleep(readyPollInterval)
+	}
+	if err := sdNotify("READY=1"); err != nil {
+		log.Println("Failed to notify systemd", "err", err)
+	}
+
+	timeout, err := sdWatchdogInterval()
+	if err != nil {
+		log.Println("Systemd watchdog disabled", "err", err)
+		return
+	}
+	if timeout == 0 {
+		return
+	}
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !m.miningHealthy(timeout) {
+			log.Println("Mining loop is not running, withholding systemd watchdog ping")
+			continue
+		}
+		if err := sdNotify("WATCHDOG=1"); err != nil {
+			log.Println("Failed to ping systemd watchdog", "err", err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/spruce-solutions/go-quai/params"
+)
+
+// ontologyTimeout bounds the request of the prime header the ontology is read from.
+const ontologyTimeout = 5 * time.Second
+
+// defaultOntology is the number of regions and zones per region used when prime can't be asked.
+var defaultOntology = params.FullerOntology
+
+// discoverOntology returns the number of regions and zones per region of the network, read
+// from the latest prime header. It falls back to the default ontology if prime is not
+// connected or its header doesn't map to a known ontology.
+func discoverOntology(prime *blockClient) (int, int) {
+	if prime == nil || !prime.available {
+		return defaultOntology[0], defaultOntology[1]
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ontologyTimeout)
+	defer cancel()
+	header, err := prime.client.HeaderByNumber(ctx, nil)
+	var ontology []int
+	if err == nil {
+		ontology, err = header.MapContext()
+	}
+	if err == nil && (len(ontology) < 2 || ontology[0] <= 0 || ontology[1] <= 0) {
+		err = errors.New("invalid ontology")
+	}
+	if err != nil {
+		log.Println("Unable to discover the slice dimensions from Prime, using the default", "regions", defaultOntology[0], "zones", defaultOntology[1], "err", err)
+		return defaultOntology[0], defaultOntology[1]
+	}
+	log.Println("Discovered the slice dimensions from Prime", "regions", ontology[0], "zones", ontology[1])
+	return ontology[0], ontology[1]
+}
+
+// maxOntology returns the largest number of regions and zones per region of the known
+// ontologies, which covers every chain any network can have.
+func maxOntology() (int, int) {
+	regions, zones := 0, 0
+	for _, ontology := range params.QuaiOntologies {
+		if ontology[0] > regions {
+			regions = ontology[0]
+		}
+		if ontology[1] > zones {
+			zones = ontology[1]
+		}
+	}
+	return regions, zones
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/spruce-solutions/quai-manager/manager/util"
+)
+
+const (
+	// unreachableSkip leaves unreachable chains out of the scan.
+	unreachableSkip = "skip"
+	// unreachableRetry retries unreachable chains before leaving them out of the scan.
+	unreachableRetry = "retry"
+	// unreachableMax treats unreachable chains as having the highest possible difficulty.
+	unreachableMax = "max"
+
+	// scopeRegion selects the easiest region first and then the easiest zone within it.
+	scopeRegion = "region"
+	// scopeNetwork compares the zones of all regions by their expected reward per hash.
+	scopeNetwork = "network"
+)
+
+// errNoReachableChain is returned by the optimizer if none of the candidate chains responded.
+var errNoReachableChain = errors.New("no candidate chain reachable")
+
+// optimizerOptions controls how findBestLocation scans the network.
+type optimizerOptions struct {
+	filter      zoneFilter
+	unreachable string // one of unreachableSkip, unreachableRetry or unreachableMax
+	retries     int    // number of retries with unreachableRetry
+	// gasTiebreak is the relative difficulty margin within which zones count as equally easy
+	// and the one producing fuller blocks is preferred, zero disables the tiebreak.
+	gasTiebreak float64
+	gasUsed     *gasTracker // recent gas used per chain, nil to only use the scanned header
+	// peers is the number of other managers of the fleet mining each location, nil when
+	// mining solo.
+	peers map[[2]byte]int
+	scope string // one of scopeRegion or scopeNetwork
+	// regionReward is the reward of a region block relative to a zone block with scopeNetwork.
+	regionReward float64
+	pacer        *scanPacer // spaces the requests of the scan, nil sends them at once
+	// currentRegion is the mined region, 0 before the first selection. Other regions need to be
+	// easier by the relative regionMargin to be selected.
+	currentRegion int
+	regionMargin  float64
+	// currentZone is the mined zone of currentRegion, 0 to compare all zones as usual. Other
+	// zones need to be easier by the relative zoneMargin to be selected.
+	currentZone int
+	zoneMargin  float64
+}
+
+// newOptimizerOptions returns the optimizer options set in the config.
+func newOptimizerOptions(config util.Config) optimizerOptions {
+	return optimizerOptions{
+		filter:       zoneFilter{include: config.OptimizerIncludeZones, exclude: config.OptimizerExcludeZones},
+		unreachable:  config.OptimizerUnreachable,
+		retries:      config.OptimizerRetries,
+		gasTiebreak:  config.OptimizerGasTiebreak,
+		scope:        config.OptimizerScope,
+		regionReward: config.OptimizerRegionReward,
+		pacer:        newScanPacer(time.Duration(config.OptimizerScanSpacing) * time.Millisecond),
+		regionMargin: config.OptimizerRegionMargin,
+	}
+}
+
+// regionBias returns the difficulty of a chain in the region raised by the region margin if
+// the region is not the mined one, so that switching regions pays off by at least the margin.
+func (o optimizerOptions) regionBias(difficulty *big.Int, region int) *big.Int {
+	if o.regionMargin <= 0 || o.currentRegion == 0 || region == o.currentRegion {
+		return difficulty
+	}
+	biased, _ := new(big.Float).Mul(new(big.Float).SetInt(difficulty), big.NewFloat(1+o.regionMargin)).Int(nil)
+	return biased
+}
+
+// zoneBias returns the difficulty of the zone raised by the zone margin if it is not the mined
+// zone, so that switching zones pays off by at least the margin.
+func (o optimizerOptions) zoneBias(difficulty *big.Int, region int, zone int) *big.Int {
+	if o.zoneMargin <= 0 || o.currentZone == 0 || (region == o.currentRegion && zone == o.currentZone) {
+		return difficulty
+	}
+	biased, _ := new(big.Float).Mul(new(big.Float).SetInt(difficulty), big.NewFloat(1+o.zoneMargin)).Int(nil)
+	return biased
+}
+
+// scanPacer spreads the requests of a scan over time so that they don't compete with the
+// mining requests to the nodes in a burst.
+type scanPacer struct {
+	spacing time.Duration
+	next    time.Time
+}
+
+// newScanPacer returns a pacer that leaves spacing between requests, nil if spacing is zero.
+func newScanPacer(spacing time.Duration) *scanPacer {
+	if spacing <= 0 {
+		return nil
+	}
+	return &scanPacer{spacing: spacing}
+}
+
+// wait blocks until spacing has passed since the previous request.
+func (p *scanPacer) wait() {
+	if p == nil {
+		return
+	}
+	if delay := time.Until(p.next); delay > 0 {
+		time.Sleep(delay)
+	}
+	p.next = time.Now().Add(p.spacing)
+}
+
+// maxDifficulty is the difficulty assumed for unreachable chains with unreachableMax.
+const maxDifficulty = math.MaxInt64
+
+// scanDifficulty returns the difficulty and gas used of the latest header of the chain in the
+// given context and whether the chain answered. Unreachable chains are handled according to the
+// options; a nil difficulty means skip.
+func (o optimizerOptions) scanDifficulty(chain chainState, sliceIndex int) (*big.Int, uint64, bool) {
+	client := chain.scanClient()
+	attempts := 1
+	if o.unreachable == unreachableRetry {
+		attempts += o.retries
+	}
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if client == nil {
+			break
+		}
+		o.pacer.wait()
+		latestHeader, err := client.HeaderByNumber(context.Background(), nil)
+		if err == nil && latestHeader.Difficulty[sliceIndex] != nil {
+			return latestHeader.Difficulty[sliceIndex], latestHeader.GasUsed[sliceIndex], true
+		}
+		log.Println("Error: connection lost during request", "context", contextNames[sliceIndex], "attempt", attempt, "err", err)
+		if attempt < attempts {
+			time.Sleep(time.Second)
+		}
+	}
+	if o.unreachable == unreachableMax {
+		return big.NewInt(maxDifficulty), 0, false
+	}
+	return nil, 0, false
+}
+
+// Examines the Quai Network to find the Region-Zone location with lowest difficulty.
+// Only zones allowed by the filter are considered. An error is returned if no region or
+// no zone in the selected region could be scanned.
+func findBestLocation(clients clientStates, options optimizerOptions) ([]byte, error) {
+	if options.scope == scopeNetwork {
+		return findBestNetworkLocation(clients, options)
+	}
+	var lowestRegion *big.Int   // lowest Region difficulty
+	var regionLocation int      // remember to return location as []byte with Zone1-1 = [1,1]
+	var lowestUnbiased *big.Int // lowest Region difficulty without the region margin
+	var easiestRegion int
+	reached := false // whether any region answered, with unreachableMax they all get a difficulty
+
+	// first find the Region chain with lowest difficulty
+	for i, region := range clients.regions {
+		if !options.filter.regionAllowed(i+1, len(clients.zones[i])) {
+			continue
+		}
+		difficulty, _, answered := options.scanDifficulty(region, 1)
+		if difficulty == nil {
+			continue
+		}
+		reached = reached || answered
+		difficulty = options.fleetDifficulty(difficulty, i+1, 0)
+		fmt.Println("region ", i+1, " difficulty ", formatDifficulty(difficulty))
+		if lowestUnbiased == nil || difficulty.Cmp(lowestUnbiased) == -1 {
+			easiestRegion = i + 1
+			lowestUnbiased = difficulty
+		}
+		difficulty = options.regionBias(difficulty, i+1)
+		if lowestRegion == nil || difficulty.Cmp(lowestRegion) == -1 {
+			regionLocation = i + 1
+			lowestRegion = difficulty
+		}
+	}
+	if regionLocation == 0 || !reached {
+		return nil, fmt.Errorf("scanning regions: %w", errNoReachableChain)
+	}
+	if regionLocation != easiestRegion {
+		log.Println("Staying in the current region within the region margin", "region", regionLocation, "easiest", easiestRegion, "margin", options.regionMargin)
+	}
+
+	// next find Zone chain inside Region with lowest difficulty
+	candidates := options.scanZones(clients, regionLocation, nil)
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("scanning zones of region %d: %w", regionLocation, errNoReachableChain)
+	}
+	return options.selectZone(candidates), nil
+}
+
+// findBestNetworkLocation compares the zones of all regions by the difficulty equivalent to the
+// expected reward per hash of mining them, which includes the blocks of their region. The zone
+// difficulties of a hard region are thereby weighed against its region difficulty instead of
+// only being compared to the zones of the easiest region.
+func findBestNetworkLocation(clients clientStates, options optimizerOptions) ([]byte, error) {
+	var candidates []zoneCandidate
+	for i, region := range clients.regions {
+		if !options.filter.regionAllowed(i+1, len(clients.zones[i])) {
+			continue
+		}
+		// the maximum difficulty of an unreachable region hardly changes the reward difficulty
+		// of its zones, so they are left out instead of mining below a region that is down
+		difficulty, _, answered := options.scanDifficulty(region, 1)
+		if difficulty == nil || !answered {
+			continue
+		}
+		difficulty = options.fleetDifficulty(difficulty, i+1, 0)
+		fmt.Println("region ", i+1, " difficulty ", formatDifficulty(difficulty))
+		for _, candidate := range options.scanZones(clients, i+1, difficulty) {
+			candidate.difficulty = options.regionBias(candidate.difficulty, candidate.region)
+			candidates = append(candidates, candidate)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("scanning zones: %w", errNoReachableChain)
+	}
+	return options.selectZone(candidates), nil
+}
+
+// scanZones scans the allowed zones of the region. If regionDifficulty is not nil the difficulty
+// of every zone is combined with it, see rewardDifficulty. No candidates are returned if none of
+// the zones answered.
+func (o optimizerOptions) scanZones(clients clientStates, region int, regionDifficulty *big.Int) []zoneCandidate {
+	var candidates []zoneCandidate
+	reached := false // whether any zone answered, with unreachableMax they all get a difficulty
+	for i, zone := range clients.zones[region-1] {
+		if !o.filter.allowed(region, i+1) {
+			continue
+		}
+		difficulty, gasUsed, answered := o.scanDifficulty(zone, 2)
+		if difficulty == nil {
+			continue
+		}
+		reached = reached || answered
+		difficulty = o.fleetDifficulty(difficulty, region, i+1)
+		if regionDifficulty != nil {
+			difficulty = o.rewardDifficulty(difficulty, regionDifficulty)
+		}
+		difficulty = o.zoneBias(difficulty, region, i+1)
+		candidate := zoneCandidate{region: region, zone: i + 1, difficulty: difficulty, gasUsed: float64(gasUsed)}
+		if recent, ok := o.gasUsed.Recent([2]byte{byte(region), byte(i + 1)}); ok {
+			candidate.gasUsed = recent
+		}
+		candidates = append(candidates, candidate)
+		fmt.Println("zone ", region, i+1, " difficulty ", formatDifficulty(difficulty), " gas used ", candidate.gasUsed)
+	}
+	if !reached {
+		return nil
+	}
+	return candidates
+}
+
+// rewardDifficulty returns the difficulty of a single chain paying the same expected reward per
+// hash as mining the zone together with its region, 1 / (1/zone + regionReward/region), where
+// regionReward is the reward of a region block relative to a zone block.
+func (o optimizerOptions) rewardDifficulty(zone *big.Int, region *big.Int) *big.Int {
+	if zone.Sign() <= 0 || region.Sign() <= 0 {
+		return zone
+	}
+	one := big.NewFloat(1)
+	perHash := new(big.Float).Quo(one, new(big.Float).SetInt(zone))
+	regionPerHash := new(big.Float).Quo(big.NewFloat(o.regionReward), new(big.Float).SetInt(region))
+	difficulty, _ := new(big.Float).Quo(one, perHash.Add(perHash, regionPerHash)).Int(nil)
+	return difficulty
+}
+
+// selectZone returns the location of the easiest candidate, or of the one producing fuller
+// blocks within the gas tiebreak margin.
+func (o optimizerOptions) selectZone(candidates []zoneCandidate) []byte {
+	easiest := 0
+	for i, candidate := range candidates {
+		if candidate.difficulty.Cmp(candidates[easiest].difficulty) == -1 {
+			easiest = i
+		}
+	}
+	best := easiest
+	if o.gasTiebreak > 0 {
+		best = o.preferFullerZone(candidates, easiest)
+	}
+
+	// print location selected
+	fmt.Println("Region location selected: ", candidates[best].region)
+	fmt.Println("Zone location selected: ", candidates[best].zone)
+	return []byte{byte(candidates[best].region), byte(candidates[best].zone)}
+}
+
+// fleetDifficulty scales the difficulty of a region, or of a zone if zone is not 0, by the number
+// of fleet managers that would mine it including this one. Managers mining a zone also mine its
+// region, so the fleet spreads over the chains with the lowest difficulty per manager.
+func (o optimizerOptions) fleetDifficulty(difficulty *big.Int, region int, zone int) *big.Int {
+	sharing := 1
+	for location, count := range o.peers {
+		if int(location[0]) == region && (zone == 0 || int(location[1]) == zone) {
+			sharing += count
+		}
+	}
+	if sharing == 1 {
+		return difficulty
+	}
+	return new(big.Int).Mul(difficulty, big.NewInt(int64(sharing)))
+}
+
+// zoneCandidate is a scanned zone the optimizer may select.
+type zoneCandidate struct {
+	region     int
+	zone       int
+	difficulty *big.Int
+	gasUsed    float64
+}
+
+// preferFullerZone returns the index of the candidate using the most gas among those whose
+// difficulty is within the tiebreak margin of the easiest one, keeping the easiest on equal gas.
+func (o optimizerOptions) preferFullerZone(candidates []zoneCandidate, easiest int) int {
+	margin := new(big.Float).Mul(new(big.Float).SetInt(candidates[easiest].difficulty), big.NewFloat(1+o.gasTiebreak))
+	best, bestGas := easiest, candidates[easiest].gasUsed
+	for i, candidate := range candidates {
+		if new(big.Float).SetInt(candidate.difficulty).Cmp(margin) > 0 {
+			continue
+		}
+		if candidate.gasUsed > bestGas {
+			best, bestGas = i, candidate.gasUsed
+		}
+	}
+	if best != easiest {
+		log.Println("Preferring zone with fuller blocks", "zone", []int{candidates[best].region, candidates[best].zone}, "easiest", []int{candidates[easiest].region, candidates[easiest].zone}, "gasUsed", bestGas)
+	}
+	return best
+}
+
+// zoneFilter restricts the locations the optimizer may select. An empty include list allows
+// every zone that is not explicitly excluded.
+type zoneFilter struct {
+	include [][]int
+	exclude [][]int
+}
+
+// containsZone reports whether the list holds the [region, zone] pair.
+func containsZone(zones [][]int, region int, zone int) bool {
+	for _, location := range zones {
+		if len(location) == 2 && location[0] == region && location[1] == zone {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed reports whether the optimizer may select the zone. Region and zone are 1-indexed.
+func (f zoneFilter) allowed(region int, zone int) bool {
+	if len(f.include) > 0 && !containsZone(f.include, region, zone) {
+		return false
+	}
+	return !containsZone(f.exclude, region, zone)
+}
+
+// regionAllowed reports whether at least one of the zones in the region may be selected.
+func (f zoneFilter) regionAllowed(region int, numZones int) bool {
+	for zone := 1; zone <= numZones; zone++ {
+		if f.allowed(region, zone) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestScanDifficultyReportsReachability(t *testing.T) {
+	options := optimizerOptions{unreachable: unreachableMax}
+
+	// a chain answering with the highest difficulty is still reachable
+	head := newTestHead(1)
+	head.Difficulty[2] = big.NewInt(math.MaxInt64)
+	chain, _ := newTestClient(t, head, false)
+	difficulty, _, answered := options.scanDifficulty(chain.state(), 2)
+	if !answered || difficulty.Cmp(big.NewInt(math.MaxInt64)) != 0 {
+		t.Fatalf("reachable chain scanned as %v, answered %v", difficulty, answered)
+	}
+
+	down, _ := newTestClient(t, newTestHead(1), true)
+	difficulty, _, answered = options.scanDifficulty(down.state(), 2)
+	if answered || difficulty == nil || difficulty.Cmp(big.NewInt(maxDifficulty)) != 0 {
+		t.Fatalf("unreachable chain scanned as %v, answered %v", difficulty, answered)
+	}
+
+	// the assumed difficulty of one unreachable chain must not change that of the next
+	difficulty.SetInt64(1)
+	if difficulty, _, _ = options.scanDifficulty(down.state(), 2); difficulty.Cmp(big.NewInt(maxDifficulty)) != 0 {
+		t.Fatalf("unreachable chain scanned as %v after a change to the previous difficulty", difficulty)
+	}
+
+	skip := optimizerOptions{unreachable: unreachableSkip}
+	if difficulty, _, answered = skip.scanDifficulty(down.state(), 2); answered || difficulty != nil {
+		t.Fatalf("unreachable chain scanned as %v, answered %v when skipped", difficulty, answered)
+	}
+}
+
+func TestFindBestLocationSkipsRegionWithUnreachableZones(t *testing.T) {
+	network := newTestNetwork(t)
+	// region 1 is the easiest but none of its zones answers
+	network.node(1, 0).head.Difficulty[1] = big.NewInt(10)
+	for zone := byte(1); zone <= 3; zone++ {
+		network.node(1, zone).down = true
+	}
+	network.node(2, 3).head.Difficulty[2] = big.NewInt(10)
+
+	options := optimizerOptions{unreachable: unreachableMax, scope: scopeRegion}
+	if location, err := findBestLocation(network.clients.states(), options); !errors.Is(err, errNoReachableChain) {
+		t.Fatalf("selected %v in a region without a reachable zone, err %v", location, err)
+	}
+
+	options.scope = scopeNetwork
+	options.regionReward = 1
+	location, err := findBestLocation(network.clients.states(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(location, []byte{2, 3}) {
+		t.Fatalf("selected %v, want the easiest reachable zone [2 3]", location)
+	}
+
+	// with every chain down nothing is selected
+	for _, node := range network.nodes {
+		node.down = true
+	}
+	if location, err := findBestLocation(network.clients.states(), options); !errors.Is(err, errNoReachableChain) {
+		t.Fatalf("selected %v without a reachable chain, err %v", location, err)
+	}
+}
+
+func TestFindBestNetworkLocationSkipsUnreachableRegion(t *testing.T) {
+	network := newTestNetwork(t)
+	// zone [1 2] is the easiest, but its region doesn't answer
+	network.node(1, 0).down = true
+	network.node(1, 2).head.Difficulty[2] = big.NewInt(10)
+	network.node(3, 1).head.Difficulty[2] = big.NewInt(100)
+
+	for _, unreachable := range []string{unreachableMax, unreachableSkip} {
+		options := optimizerOptions{unreachable: unreachable, scope: scopeNetwork, regionReward: 1}
+		location, err := findBestLocation(network.clients.states(), options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(location, []byte{3, 1}) {
+			t.Errorf("%s: selected %v, want the easiest zone [3 1] of a reachable region", unreachable, location)
+		}
+	}
+}
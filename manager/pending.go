@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/spruce-solutions/go-quai/common"
+	"github.com/spruce-solutions/go-quai/core/types"
+)
+
+// pendingBlock is a block template tagged with the mining location it was fetched for.
+type pendingBlock struct {
+	block    *types.ReceiptBlock
+	location []byte
+}
+
+// matchesLocation reports whether the template is still valid for mining at the given location.
+// Prime templates are the same for every location, region templates only depend on the region.
+func (p *pendingBlock) matchesLocation(location []byte, sliceIndex int) bool {
+	switch sliceIndex {
+	case 1:
+		return len(p.location) > 0 && len(location) > 0 && p.location[0] == location[0]
+	case 2:
+		return bytes.Equal(p.location, location)
+	}
+	return true
+}
+
+// pendingBlockKey identifies the template of a context, pending blocks with the same key only
+// differ in fields that don't change the work.
+type pendingBlockKey struct {
+	chain  [2]byte
+	number string
+	root   common.Hash
+	txHash common.Hash
+}
+
+// key returns the key of the template in the given context.
+func (p *pendingBlock) key(sliceIndex int) pendingBlockKey {
+	header := p.block.Header()
+	return pendingBlockKey{
+		chain:  chainLocation(p.location, sliceIndex),
+		number: fmt.Sprint(header.Number[sliceIndex]),
+		root:   header.Root[sliceIndex],
+		txHash: header.TxHash[sliceIndex],
+	}
+}
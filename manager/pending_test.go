@@ -0,0 +1,90 @@
+package main
+
+import (
+	"math/big"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPendingBlockMatchesLocation(t *testing.T) {
+	tests := []struct {
+		fetched, current []byte
+		sliceIndex       int
+		want             bool
+	}{
+		{[]byte{0, 0}, []byte{1, 1}, 0, true},
+		{[]byte{1, 0}, []byte{1, 2}, 1, true},
+		{[]byte{0, 0}, []byte{1, 0}, 1, false},
+		{[]byte{1, 1}, []byte{1, 1}, 2, true},
+		{[]byte{1, 0}, []byte{1, 1}, 2, false},
+		{[]byte{0, 1}, []byte{1, 1}, 2, false},
+		{nil, []byte{1, 1}, 1, false},
+		{nil, []byte{1, 1}, 2, false},
+	}
+	for _, test := range tests {
+		pending := &pendingBlock{location: test.fetched}
+		if got := pending.matchesLocation(test.current, test.sliceIndex); got != test.want {
+			t.Errorf("%s block fetched for %v matches %v: got %v, want %v", contextNames[test.sliceIndex], test.fetched, test.current, got, test.want)
+		}
+	}
+}
+
+func TestHandlePendingBlockAfterSwitch(t *testing.T) {
+	for _, discard := range []bool{true, false} {
+		m := newTestManager(newFakeEngine(), []byte{0, 0})
+		config := *m.cfg()
+		config.DiscardStalePendingBlocks = discard
+		m.config.Store(&config)
+
+		// fetched for the old location and still in flight when the optimizer switches
+		inFlight := newTestPendingBlock(2, 10, []byte{0, 0})
+		m.withLock(func() { m.location = []byte{1, 1} })
+		m.handlePendingBlock(inFlight, 2)
+
+		merged := m.pendingBlocks[2] == inFlight.block
+		if merged == discard {
+			t.Errorf("with DiscardStalePendingBlocks %v the stale zone block was merged: %v", discard, merged)
+		}
+		if notified := len(m.updatedCh) > 0; notified == discard {
+			t.Errorf("with DiscardStalePendingBlocks %v the miner was notified of the stale zone block: %v", discard, notified)
+		}
+		if got := m.combinedHeader.Number[2].Int64(); discard && got != 1 {
+			t.Errorf("stale zone block changed the combined header to number %d", got)
+		}
+
+		// the template for the new location is merged either way
+		current := newTestPendingBlock(2, 20, []byte{1, 1})
+		m.handlePendingBlock(current, 2)
+		if m.pendingBlocks[2] != current.block || m.combinedHeader.Number[2].Int64() != 20 {
+			t.Errorf("with DiscardStalePendingBlocks %v the zone block of the new location was not merged", discard)
+		}
+	}
+}
+
+func TestRequestNewerPendingBlockRefetchesOnlyOlderBlocks(t *testing.T) {
+	tests := []struct {
+		mining   int64
+		requests int32
+	}{
+		{1, 1}, // ahead of the mined block
+		{2, 1}, // a template refresh at the mined number
+		{3, 3}, // behind the mined block, refetched MaxStaleRefetches times
+	}
+	for _, test := range tests {
+		m := newTestManager(newFakeEngine(), []byte{1, 1})
+		config := *m.cfg()
+		config.MaxStaleRefetches = 2
+		m.config.Store(&config)
+		m.combinedHeader.Number[2] = big.NewInt(test.mining)
+		zone, node := newTestClient(t, newTestHead(1), false)
+		node.pending = newTestTemplate([]byte{1, 1})
+
+		_, receiptBlock, err := m.requestNewerPendingBlock(zone.client, 2)
+		if err != nil || receiptBlock == nil {
+			t.Fatalf("mining %d: no pending block, err %v", test.mining, err)
+		}
+		if got := atomic.LoadInt32(&node.pendingRequests); got != test.requests {
+			t.Errorf("mining %d: requested the pending block %d times, want %d", test.mining, got, test.requests)
+		}
+	}
+}
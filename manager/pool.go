@@ -0,0 +1,62 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+
+	"github.com/spruce-solutions/go-quai/ethclient"
+	"github.com/spruce-solutions/quai-manager/manager/util"
+)
+
+// dialPool opens size-1 additional connections to the node at the URL, so that concurrent
+// relays to the chain are spread over size connections. Connections that fail to open are left
+// out of the pool. The dials block, once the manager runs they are made outside the lock and
+// the pool swapped in under it.
+func dialPool(url string, size int, options dialOptions) []*ethclient.Client {
+	var pool []*ethclient.Client
+	for i := 1; i < size; i++ {
+		client, err := dialNode(url, options)
+		if err != nil {
+			log.Println("Unable to open pooled connection to node", "url", util.RedactURL(url), "err", err)
+			continue
+		}
+		pool = append(pool, ethclient.NewClient(client))
+	}
+	return pool
+}
+
+// relayClient returns the connections of the chain round-robin, the main connection if there
+// is no pool.
+func (s chainState) relayClient() *ethclient.Client {
+	if len(s.pool) == 0 {
+		return s.client
+	}
+	next := atomic.AddUint32(s.next, 1) % uint32(len(s.pool)+1)
+	if next == 0 {
+		return s.client
+	}
+	return s.pool[next-1]
+}
+
+// dialScan opens the connection the optimizer scans the chain through if enabled, so that its
+// requests don't queue behind the mining ones. If it fails to open, nil is returned and the scan
+// falls back to the main connection. Like dialPool it is made outside the lock.
+func dialScan(url string, enabled bool, options dialOptions) *ethclient.Client {
+	if !enabled {
+		return nil
+	}
+	client, err := dialNode(url, options)
+	if err != nil {
+		log.Println("Unable to open optimizer connection to node", "url", util.RedactURL(url), "err", err)
+		return nil
+	}
+	return ethclient.NewClient(client)
+}
+
+// scanClient returns the connection the optimizer scans the chain through.
+func (s chainState) scanClient() *ethclient.Client {
+	if s.scan != nil && s.client != nil {
+		return s.scan
+	}
+	return s.client
+}
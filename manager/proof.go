@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/spruce-solutions/go-quai/common"
+	"github.com/spruce-solutions/go-quai/consensus/blake3"
+	"github.com/spruce-solutions/go-quai/core/types"
+)
+
+var (
+	// errInvalidProof is returned for proofs without a header or with an unknown context.
+	errInvalidProof = errors.New("invalid proof")
+	// errProofMismatch is returned for proofs whose claims don't match their sealed header.
+	errProofMismatch = errors.New("proof doesn't match its header")
+)
+
+// minedProof is the proof of a mined block, which lets the seal be verified without a node.
+// Blake3 headers carry no mix digest, so the seal is checked from the header and its nonce alone.
+type minedProof struct {
+	Context  int              `json:"context"`
+	SealHash common.Hash      `json:"sealHash"`
+	Nonce    types.BlockNonce `json:"nonce"`
+	Targets  []*big.Int       `json:"targets"` // 2^256 / difficulty per context, nil without one
+	Header   *types.Header    `json:"header"`
+}
+
+// proofTargets returns the targets of the difficulties of the header.
+func proofTargets(header *types.Header) []*big.Int {
+	targets := make([]*big.Int, len(header.Difficulty))
+	for i, difficulty := range header.Difficulty {
+		if difficulty != nil && difficulty.Sign() > 0 {
+			targets[i] = new(big.Int).Div(big2e256, difficulty)
+		}
+	}
+	return targets
+}
+
+// writeProof writes the proof of the header mined for the context to the proof directory,
+// named by the block hash.
+func writeProof(dir string, mined int, sealHash common.Hash, header *types.Header) error {
+	proof := &minedProof{
+		Context:  mined,
+		SealHash: sealHash,
+		Nonce:    header.Nonce,
+		Targets:  proofTargets(header),
+		Header:   header,
+	}
+	data, err := json.MarshalIndent(proof, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, header.Hash().Hex()+".json"), data, 0644)
+}
+
+// verifyProof checks that the proof matches its header and that the seal meets the difficulty
+// of the claimed context. It returns the highest context the seal meets.
+func verifyProof(engine powEngine, proof *minedProof) (int, error) {
+	if proof.Header == nil || proof.Context < 0 || proof.Context >= len(contextNames) {
+		return 0, errInvalidProof
+	}
+	header := proof.Header
+	if header.Nonce != proof.Nonce {
+		return 0, fmt.Errorf("%w: nonce %x, header has %x", errProofMismatch, proof.Nonce, header.Nonce)
+	}
+	if sealHash := engine.SealHash(header); sealHash != proof.SealHash {
+		return 0, fmt.Errorf("%w: seal hash %v, header has %v", errProofMismatch, proof.SealHash, sealHash)
+	}
+	targets := proofTargets(header)
+	if len(proof.Targets) != len(targets) {
+		return 0, fmt.Errorf("%w: %d targets, header has %d difficulties", errProofMismatch, len(proof.Targets), len(targets))
+	}
+	for i, target := range targets {
+		if (target == nil) != (proof.Targets[i] == nil) || (target != nil && target.Cmp(proof.Targets[i]) != 0) {
+			return 0, fmt.Errorf("%w: %s target", errProofMismatch, contextNames[i])
+		}
+	}
+	order, err := engine.GetDifficultyOrder(header)
+	if err != nil {
+		return 0, err
+	}
+	if order > proof.Context {
+		return order, fmt.Errorf("seal meets the %s difficulty only, not %s", contextNames[order], contextNames[proof.Context])
+	}
+	return order, nil
+}
+
+// runVerifyProof is the verify-proof command. It verifies the proof files offline with the
+// blake3 engine and exits non-zero if any of them fails.
+func runVerifyProof(paths []string) {
+	if len(paths) == 0 {
+		log.Fatal("verify-proof needs the proof files to verify")
+	}
+	engine, err := blake3.New(blake3.Config{}, nil, false)
+	if err != nil {
+		log.Fatal("Failed to create Blake3 engine: ", err)
+	}
+	defer engine.Close()
+
+	failed := 0
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		var proof minedProof
+		if err == nil {
+			err = json.Unmarshal(data, &proof)
+		}
+		order := 0
+		if err == nil {
+			order, err = verifyProof(engine, &proof)
+		}
+		if err != nil {
+			fmt.Printf("%s: invalid: %v\n", path, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s: valid %s block %v, seal meets %s\n", path, contextNames[proof.Context], proof.Header.Hash(), contextNames[order])
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/spruce-solutions/go-quai/metrics"
+)
+
+// queueWarnFill is the fill, as a fraction of the capacity, from which a queue is logged as
+// backing up. A full result or update queue drops what the miner sends next.
+const queueWarnFill = 0.75
+
+// queueDisabledPoll is how often the queue diagnostics check for a reload that enables them again.
+const queueDisabledPoll = 10 * time.Second
+
+// queueDepth is the length and capacity of one of the manager's queues.
+type queueDepth struct {
+	name     string
+	len, cap int
+}
+
+// queueDepths returns the lengths and capacities of the pending block, update, result and
+// submission queues.
+func (m *Manager) queueDepths() []queueDepth {
+	depths := []queueDepth{
+		{"pending/prime", len(m.pendingPrimeBlockCh), cap(m.pendingPrimeBlockCh)},
+		{"pending/region", len(m.pendingRegionBlockCh), cap(m.pendingRegionBlockCh)},
+		{"pending/zone", len(m.pendingZoneBlockCh), cap(m.pendingZoneBlockCh)},
+		{"updated", len(m.updatedCh), cap(m.updatedCh)},
+		{"result", len(m.resultCh), cap(m.resultCh)},
+	}
+	for i, ch := range m.submitChs {
+		depths = append(depths, queueDepth{"submit/" + contextNames[i], len(ch), cap(ch)})
+	}
+	return depths
+}
+
+// logQueueDepths logs the length and capacity of the manager's queues every
+// QueueDiagnosticInterval seconds and sets their manager/queue/* gauges, warning when one of
+// them is at least queueWarnFill full.
+func (m *Manager) logQueueDepths() {
+	gauges := make(map[string]metrics.Gauge)
+	for {
+		// read for every line, so that a reload of QueueDiagnosticInterval applies to the next one
+		interval := time.Duration(m.cfg().QueueDiagnosticInterval) * time.Second
+		if interval <= 0 {
+			// disabled, wait for a reload that enables it
+			time.Sleep(queueDisabledPoll)
+			continue
+		}
+		time.Sleep(interval)
+		var ctx, backedUp []interface{}
+		for _, depth := range m.queueDepths() {
+			gauge, ok := gauges[depth.name]
+			if !ok {
+				gauge = newGaugeForced("manager/queue/" + depth.name)
+				gauges[depth.name] = gauge
+			}
+			gauge.Update(int64(depth.len))
+			value := fmt.Sprintf("%d/%d", depth.len, depth.cap)
+			ctx = append(ctx, depth.name, value)
+			if depth.cap > 0 && float64(depth.len) >= queueWarnFill*float64(depth.cap) {
+				backedUp = append(backedUp, depth.name, value)
+			}
+		}
+		log.Println(append([]interface{}{"Queue depths"}, ctx...)...)
+		if len(backedUp) > 0 {
+			log.Println(append([]interface{}{"Queues are backing up, the miner may drop results"}, backedUp...)...)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/spruce-solutions/go-quai/common"
+	"github.com/spruce-solutions/go-quai/core/types"
+	"github.com/spruce-solutions/go-quai/ethclient"
+	"github.com/spruce-solutions/go-quai/metrics"
+	"github.com/spruce-solutions/go-quai/trie"
+)
+
+// errInconsistentReceipts is returned for receipts that don't belong to the block they were
+// fetched for, e.g. when a reorg happened between fetching the block and its receipts.
+var errInconsistentReceipts = errors.New("receipts don't match the block")
+
+// receiptMismatchCounter counts the receipts found not to match their block, refetches included.
+var receiptMismatchCounter = metrics.NewRegisteredCounterForced("manager/receipts/mismatch", nil)
+
+// checkReceipts returns an error unless the receipts are those of the block in the chain
+// context: one per transaction, recorded for the block if they name one, and hashing to the
+// block's receipt root.
+func checkReceipts(block *types.Block, receipts []*types.Receipt, chainContext int) error {
+	if len(receipts) != len(block.Transactions()) {
+		return fmt.Errorf("%w: %d receipts for %d transactions", errInconsistentReceipts, len(receipts), len(block.Transactions()))
+	}
+	hash := block.Hash()
+	for i, receipt := range receipts {
+		if receipt == nil {
+			return fmt.Errorf("%w: receipt %d missing", errInconsistentReceipts, i)
+		}
+		if receipt.BlockHash != (common.Hash{}) && receipt.BlockHash != hash {
+			return fmt.Errorf("%w: receipt %d is for block %v", errInconsistentReceipts, i, receipt.BlockHash)
+		}
+	}
+	header := block.Header()
+	if chainContext < 0 || chainContext >= len(header.ReceiptHash) {
+		return fmt.Errorf("%w: no receipt root for context %d", errInconsistentReceipts, chainContext)
+	}
+	if root := types.DeriveSha(types.Receipts(receipts), trie.NewStackTrie(nil)); root != header.ReceiptHash[chainContext] {
+		return fmt.Errorf("%w: receipt root %v, block has %v", errInconsistentReceipts, root, header.ReceiptHash[chainContext])
+	}
+	return nil
+}
+
+// checkReceiptBlock returns an error unless the receipt block is the block with its receipts.
+func checkReceiptBlock(block *types.Block, receiptBlock *types.ReceiptBlock, chainContext int) error {
+	if receiptBlock == nil {
+		return fmt.Errorf("%w: no receipt block", errInconsistentReceipts)
+	}
+	if hash := receiptBlock.Header().Hash(); hash != block.Hash() {
+		return fmt.Errorf("%w: receipt block is %v", errInconsistentReceipts, hash)
+	}
+	return checkReceipts(block, receiptBlock.Receipts(), chainContext)
+}
+
+// blockReceipts returns the receipt block of the block of the chain context. With
+// VerifyExternalReceipts set, receipts that don't match the block are dropped from the cache and
+// fetched again once, and an error is returned if they still don't match.
+func (m *Manager) blockReceipts(client *ethclient.Client, block *types.Block, chainContext int) (*types.ReceiptBlock, error) {
+	receiptBlock, err := m.receiptCache.GetBlockReceipts(client, block.Hash())
+	if err != nil || !m.cfg().VerifyExternalReceipts {
+		return receiptBlock, err
+	}
+	err = checkReceiptBlock(block, receiptBlock, chainContext)
+	if err == nil {
+		return receiptBlock, nil
+	}
+	receiptMismatchCounter.Inc(1)
+	log.Println("Receipts don't match their block, fetching them again", "hash", block.Hash(), "context", contextNames[chainContext], "err", err)
+	m.receiptCache.Forget(block.Hash())
+	receiptBlock, err = m.receiptCache.GetBlockReceipts(client, block.Hash())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkReceiptBlock(block, receiptBlock, chainContext); err != nil {
+		receiptMismatchCounter.Inc(1)
+		m.receiptCache.Forget(block.Hash())
+		return nil, err
+	}
+	return receiptBlock, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/spruce-solutions/go-quai/ethclient"
+	"github.com/spruce-solutions/quai-manager/manager/util"
+)
+
+// reconnectInterval is the delay between attempts to connect the chains that were offline.
+const reconnectInterval = 30 * time.Second
+
+// requiredSlice returns the location the manager is going to mine, nil if the optimizer picks it.
+func requiredSlice(config util.Config, args []string) []byte {
+	if len(args) > 2 {
+		region, _ := strconv.Atoi(args[0])
+		zone, _ := strconv.Atoi(args[1])
+		return []byte{byte(region), byte(zone)}
+	}
+	if config.Auto && config.Mine {
+		return nil
+	}
+	return config.Location
+}
+
+// sliceOnline reports whether prime, unless hasPrime is false, and the region and zone of the
+// location are connected. If location is nil any connected zone whose region is connected will do.
+func sliceOnline(clients clientStates, location []byte, hasPrime bool) bool {
+	if hasPrime && !clients.prime.available {
+		return false
+	}
+	if location == nil {
+		for i := range clients.regions {
+			for j := range clients.zones[i] {
+				if clients.regions[i].available && clients.zones[i][j].available {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if len(location) != 2 || location[0] < 1 || int(location[0]) > len(clients.regions) || int(location[0]) > len(clients.zones) || location[1] < 1 || int(location[1]) > len(clients.zones[location[0]-1]) {
+		return false
+	}
+	return clients.regions[location[0]-1].available && clients.zones[location[0]-1][location[1]-1].available
+}
+
+// allChainsConnected reports whether every configured chain is connected, prime only if
+// hasPrime is set.
+func allChainsConnected(clients clientStates, hasPrime bool) bool {
+	if hasPrime && !clients.prime.available {
+		return false
+	}
+	for i, region := range clients.regions {
+		if region.url != "" && !region.available {
+			return false
+		}
+		for _, zone := range clients.zones[i] {
+			if zone.url != "" && !zone.available {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// reconnectChains keeps dialing the configured chains that are offline and starts their
+// subscriptions once they connect. It returns when all chains are connected, use
+// startReconnect to run it.
+func (m *Manager) reconnectChains() {
+	defer atomic.StoreInt32(&m.reconnecting, 0)
+	ticker := time.NewTicker(reconnectInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		offline := 0
+		states := m.chainStates()
+		for i, region := range m.orderedBlockClients.regions {
+			if state := states.regions[i]; state.available || state.url == "" {
+				continue
+			}
+			if client := m.reconnectChain(region, "Region", i+1); client != nil {
+				m.subscribeChain(client, 1, []byte{uint8(i + 1), 0})
+			} else {
+				offline++
+			}
+		}
+		for i, zones := range m.orderedBlockClients.zones {
+			for j, zone := range zones {
+				if state := states.zones[i][j]; state.available || state.url == "" {
+					continue
+				}
+				if client := m.reconnectChain(zone, "Zone", i+1, j+1); client != nil {
+					m.subscribeChain(client, 2, []byte{uint8(i + 1), uint8(j + 1)})
+				} else {
+					offline++
+				}
+			}
+		}
+		if offline == 0 {
+			log.Println("All chains connected")
+			return
+		}
+	}
+}
+
+// reconnectChain dials the chain and returns its new client, nil if it didn't connect. The URL
+// of a region or zone doesn't change once the manager runs.
+func (m *Manager) reconnectChain(c *blockClient, name string, location ...int) *ethclient.Client {
+	chain := make([]byte, 2)
+	for i, loc := range location {
+		chain[i] = byte(loc)
+	}
+	options := newDialOptions(*m.cfg(), chain)
+	client, err := dialNode(c.url, options)
+	if err != nil {
+		return nil
+	}
+	pool := dialPool(c.url, m.cfg().RelayPoolSizes.At(len(location)), options)
+	// the optimizer only scans regions and zones
+	scan := dialScan(c.url, m.cfg().OptimizerConnection && len(location) > 0, options)
+	var connected *ethclient.Client
+	m.withLock(func() {
+		c.connect(client)
+		c.pool, c.scan = pool, scan
+		connected = c.client
+	})
+	log.Println("Connected to node:", name, location, c.redactedURL())
+	return connected
+}
+
+// subscribeChain starts the new head and missing external block subscriptions of a chain.
+func (m *Manager) subscribeChain(client *ethclient.Client, difficultyContext int, chain []byte) {
+	safeGo(fmt.Sprint("subscribeNewHeadClient ", chain), func() { m.subscribeNewHeadClient(client, difficultyContext) })
+	safeGo(fmt.Sprint("subscribeMissingExternalBlockClient ", chain), func() { m.subscribeMissingExternalBlockClient(client, chain) })
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/spruce-solutions/go-quai/common"
+	"github.com/spruce-solutions/go-quai/core/types"
+	"github.com/spruce-solutions/go-quai/rpc"
+)
+
+// serveTestNode serves the node over HTTP so that the manager can dial it by URL.
+func serveTestNode(t *testing.T, node *testNode) string {
+	t.Helper()
+	server := rpc.NewServer()
+	if err := server.RegisterName("quai", node); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Stop)
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return httpServer.URL
+}
+
+// TestReconnectDuringNewHeadRelay runs the reconnects of a zone while the new head relay and the
+// optimizer send to it, run with -race to catch reads of the connections outside the lock.
+func TestReconnectDuringNewHeadRelay(t *testing.T) {
+	engine := newFakeEngine()
+	engine.order = 1
+	m := newTestManager(engine, []byte{1, 1})
+	config := *m.cfg()
+	config.RelayPoolSizes.Zone = 2
+	config.OptimizerConnection = true
+	m.config.Store(&config)
+	network := newTestNetwork(t)
+	m.orderedBlockClients = network.clients
+	zone := network.clients.zones[0][0]
+	zone.url = serveTestNode(t, network.node(1, 1))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			m.withLock(zone.disconnect)
+			if m.reconnectChain(zone, "Zone", 1, 1) == nil {
+				t.Error("zone [1 1] didn't reconnect")
+				return
+			}
+		}
+	}()
+	header := newTestTemplate([]byte{1, 1})
+	block := types.NewExternalBlockWithHeader(header)
+	options := optimizerOptions{unreachable: unreachableMax, scope: scopeRegion}
+	for i := 0; i < 20; i++ {
+		m.sendSealedBlock(block, 2)
+		m.SendClientsExtBlock(context.Background(), 1, []int{0, 2}, types.NewBlockWithHeader(header), types.NewReceiptBlockWithHeader(header))
+		if _, err := findBestLocation(m.chainStates(), options); err != nil {
+			t.Error(err)
+		}
+		m.getExternalBlock(common.Hash{}, 2, []byte{1, 1})
+		m.allChainsOnline()
+		m.locationReachable([]byte{1, 1})
+	}
+	wg.Wait()
+
+	if state := m.chainState(zone); !state.available || len(state.pool) != 1 || state.scan == nil {
+		t.Errorf("zone [1 1] available %v with %d pooled connections and scan %v after the last reconnect, want 1 and a scan", state.available, len(state.pool), state.scan != nil)
+	}
+}
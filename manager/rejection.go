@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/spruce-solutions/go-quai/consensus"
+	"github.com/spruce-solutions/go-quai/core/types"
+	"github.com/spruce-solutions/go-quai/ethclient"
+	"github.com/spruce-solutions/go-quai/rpc"
+)
+
+// The rejections of a mined block the manager can recover from by relaying the external blocks
+// of the other contexts to the node again.
+const (
+	rejectionUnknownAncestor = "unknown ancestor"
+	rejectionMissingExternal = "missing external block"
+)
+
+// rejectionReason returns the reason the node gave for rejecting a mined block, with the JSON-RPC
+// error code if there is one, and whether resending the external blocks may resolve it.
+func rejectionReason(err error) (string, int, bool) {
+	code := 0
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		code = rpcErr.ErrorCode()
+	}
+	reason := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(reason, consensus.ErrUnknownAncestor.Error()):
+		return rejectionUnknownAncestor, code, true
+	case strings.Contains(reason, "external block") && (strings.Contains(reason, "not found") || strings.Contains(reason, "missing")):
+		return rejectionMissingExternal, code, true
+	}
+	return err.Error(), code, false
+}
+
+// resubmitRejected resends the external blocks of the other contexts the header was sealed for
+// to the chain that rejected the mined block with a recoverable reason and submits the block
+// once more. It returns the error of the resubmission.
+func (m *Manager) resubmitRejected(ctx context.Context, mined int, header *types.Header, pending []*types.ReceiptBlock, target []byte, client *ethclient.Client, sealed *types.Block, inclTx, fullTx bool) error {
+	for i, receiptBlock := range pending {
+		if i == mined || receiptBlock == nil || len(header.Number) <= i || header.Number[i] == nil {
+			continue
+		}
+		block := types.NewBlockWithHeader(header).WithBody(receiptBlock.Transactions(), receiptBlock.Uncles())
+		if err := m.checkExternalContext(block.Header(), i); err != nil {
+			continue
+		}
+		err := m.sendExternalBlock(ctx, target, client, block, receiptBlock.Receipts(), i)
+		m.logSend("external block", target, block.Hash(), i, err)
+	}
+	err := client.SendMinedBlock(ctx, sealed, inclTx, fullTx)
+	if err == nil {
+		log.Println("Resubmitted rejected mined block", "target", target, "context", contextNames[mined], "hash", sealed.Hash())
+	}
+	return err
+}
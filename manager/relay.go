@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/spruce-solutions/go-quai/common"
+	"github.com/spruce-solutions/go-quai/core/types"
+	"github.com/spruce-solutions/go-quai/ethclient"
+)
+
+// relayTarget is a chain an external block is relayed to. The location is [0, 0] for prime,
+// [region, 0] for a region and [region, zone] for a zone.
+type relayTarget struct {
+	location []byte
+	client   *ethclient.Client
+}
+
+// relayExternalBlock sends the external block to all targets concurrently using at most
+// RelayWorkers sends at a time, so that a slow chain doesn't hold up the others. It returns
+// the error of each target, nil for the successful ones.
+func (m *Manager) relayExternalBlock(ctx context.Context, targets []relayTarget, block *types.Block, receipts []*types.Receipt, mined int) []error {
+	workers := m.cfg().RelayWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+	var (
+		wg      sync.WaitGroup
+		slots   = make(chan struct{}, workers)
+		results = make([]error, len(targets))
+	)
+	for i, target := range targets {
+		if target.client == nil {
+			continue
+		}
+		wg.Add(1)
+		slots <- struct{}{}
+		i, target := i, target
+		goRecovered("sendExternalBlock", func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			results[i] = m.externalSends.do(newExternalSendKey(target.location, block.Hash(), mined), func() error {
+				return m.sendExternalBlock(ctx, target.location, target.client, block, receipts, mined)
+			})
+		})
+	}
+	wg.Wait()
+
+	for i, err := range results {
+		if targets[i].client == nil {
+			continue
+		}
+		m.externalSubmissions.Record(mined, err)
+		incChainCounter(relayedExternalCounters, targets[i].location)
+		m.logSend("external block", targets[i].location, block.Hash(), mined, err)
+	}
+	return results
+}
+
+// externalSendKey identifies the send of an external block to a chain.
+type externalSendKey struct {
+	target  [2]byte
+	hash    common.Hash
+	context int
+}
+
+func newExternalSendKey(target []byte, hash common.Hash, difficultyContext int) externalSendKey {
+	return externalSendKey{target: [2]byte{target[0], target[1]}, hash: hash, context: difficultyContext}
+}
+
+// externalSend is a send in flight, done is closed once err is set.
+type externalSend struct {
+	done chan struct{}
+	err  error
+}
+
+// externalSends coalesces concurrent sends of the same external block to the same chain, so that
+// the proactive relay and the missing external block handler don't both issue the RPC. It also
+// remembers the successful sends of the last window.
+type externalSends struct {
+	lock     sync.Mutex
+	inflight map[externalSendKey]*externalSend
+	window   time.Duration
+	sent     map[externalSendKey]time.Time
+}
+
+// newExternalSends creates the sends, remembering the successful ones for window.
+func newExternalSends(window time.Duration) *externalSends {
+	return &externalSends{
+		inflight: make(map[externalSendKey]*externalSend),
+		window:   window,
+		sent:     make(map[externalSendKey]time.Time),
+	}
+}
+
+// recentlySent reports whether the same send succeeded within the window.
+func (s *externalSends) recentlySent(key externalSendKey) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	sent, ok := s.sent[key]
+	return ok && time.Since(sent) < s.window
+}
+
+// do runs send unless the same send is already in flight, in which case it waits for that one
+// and returns its result.
+func (s *externalSends) do(key externalSendKey, send func() error) error {
+	s.lock.Lock()
+	if running, ok := s.inflight[key]; ok {
+		s.lock.Unlock()
+		<-running.done
+		return running.err
+	}
+	running := &externalSend{done: make(chan struct{})}
+	s.inflight[key] = running
+	s.lock.Unlock()
+
+	running.err = send()
+
+	s.lock.Lock()
+	delete(s.inflight, key)
+	if running.err == nil && s.window > 0 {
+		now := time.Now()
+		for sentKey, sent := range s.sent {
+			if now.Sub(sent) >= s.window {
+				delete(s.sent, sentKey)
+			}
+		}
+		s.sent[key] = now
+	}
+	s.lock.Unlock()
+	close(running.done)
+	return running.err
+}
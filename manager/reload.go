@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+
+	"github.com/spruce-solutions/quai-manager/manager/util"
+)
+
+// reloadableFields are the config fields that are read where they are used and can therefore
+// be changed while the manager runs. Changes to any other field need a restart.
+var reloadableFields = map[string]bool{
+	"OptimizeTimer":             true,
+	"OptimizerIncludeZones":     true,
+	"OptimizerExcludeZones":     true,
+	"OptimizerUnreachable":      true,
+	"OptimizerRetries":          true,
+	"OptimizerGasTiebreak":      true,
+	"OptimizerScope":            true,
+	"OptimizerRegionReward":     true,
+	"OptimizerRegionMargin":     true,
+	"OptimizerScanSpacing":      true,
+	"DiscardStalePendingBlocks": true,
+	"DedupPendingBlocks":        true,
+	"MaxStaleRefetches":         true,
+	"VerifyPendingParent":       true,
+	"MaxPendingBlockAge":        true,
+	"ContextTimings":            true,
+	"VerifyExternalBlocks":      true,
+	"ExternalBlockResends":      true,
+	"BackfillMinedNumbers":      true,
+	"ResubmitRejectedBlocks":    true,
+	"ReportZeroHashrate":        true,
+	"LogSubmissionTargets":      true,
+	"ReactiveExternalRelayOnly": true,
+	"MineContexts":              true,
+	"MinedBlockEncodings":       true,
+	"OfflineSubmitGrace":        true,
+	"ProofDir":                  true,
+	"VerifyExternalReceipts":    true,
+	"CoalesceNewHeads":          true,
+	"DashboardInterval":         true,
+	"QueueDiagnosticInterval":   true,
+}
+
+// validateReload checks the values of the reloadable fields that the manager can't recover
+// from at runtime.
+func validateReload(config util.Config) error {
+	if config.OptimizeTimer <= 0 {
+		return fmt.Errorf("OptimizeTimer must be positive, got %d", config.OptimizeTimer)
+	}
+	if config.OptimizerScope != scopeRegion && config.OptimizerScope != scopeNetwork {
+		return fmt.Errorf("unknown OptimizerScope %q", config.OptimizerScope)
+	}
+	if config.OptimizerUnreachable != unreachableSkip && config.OptimizerUnreachable != unreachableRetry && config.OptimizerUnreachable != unreachableMax {
+		return fmt.Errorf("unknown OptimizerUnreachable %q", config.OptimizerUnreachable)
+	}
+	return nil
+}
+
+// reloadConfig loads the config again and applies the changed reloadable fields. loaded is the
+// config as it was last loaded, before main adjusted it, and is updated to the new one.
+func (m *Manager) reloadConfig(path string, profile string, loaded *util.Config) {
+	config, err := util.LoadConfig(path, profile)
+	if err == nil {
+		err = validateReload(config)
+	}
+	if err != nil {
+		log.Println("Failed to reload config, keeping the current one", "err", err)
+		return
+	}
+
+	// the running config is copied and swapped, the goroutines reading it don't take the lock
+	var applied, restart []string
+	updated := *m.cfg()
+	previous := reflect.ValueOf(loaded).Elem()
+	next := reflect.ValueOf(config)
+	current := reflect.ValueOf(&updated).Elem()
+	for i := 0; i < next.NumField(); i++ {
+		name := next.Type().Field(i).Name
+		if reflect.DeepEqual(previous.Field(i).Interface(), next.Field(i).Interface()) {
+			continue
+		}
+		if !reloadableFields[name] {
+			restart = append(restart, name)
+			continue
+		}
+		current.Field(i).Set(next.Field(i))
+		applied = append(applied, name)
+	}
+	m.config.Store(&updated)
+	// restart-only fields keep their loaded value so that they are reported until restarted
+	for _, name := range applied {
+		previous.FieldByName(name).Set(next.FieldByName(name))
+	}
+
+	if contains(applied, "MineContexts") {
+		m.mineContexts.Set(0, config.MineContexts.Prime)
+		m.mineContexts.Set(1, config.MineContexts.Region)
+		m.mineContexts.Set(2, config.MineContexts.Zone)
+	}
+	if contains(applied, "OptimizeTimer") {
+		select {
+		case m.optimizeTimerCh <- config.OptimizeTimer:
+		default:
+		}
+	}
+	log.Println("Config reloaded", "applied", applied, "restartRequired", restart)
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// reloadOnHangup reloads the config every time the process receives SIGHUP.
+func (m *Manager) reloadOnHangup(path string, profile string, loaded util.Config) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		m.reloadConfig(path, profile, &loaded)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/spruce-solutions/quai-manager/manager/util"
+)
+
+func TestReloadSwapsConfigWhileRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(config string) {
+		if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("OptimizeTimer: 1\nDashboardInterval: 5\nCoordinationKey: before\n")
+	loaded, err := util.LoadConfig(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newTestManager(newFakeEngine(), []byte{0, 0})
+	running := loaded
+	m.config.Store(&running)
+	before := m.cfg()
+
+	// readers don't take the lock, the race detector fails the test if a reload writes to the
+	// config they read
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				_ = newOptimizerOptions(*m.cfg())
+				_ = m.cfg().DashboardInterval
+			}
+		}()
+	}
+
+	write("OptimizeTimer: 1\nDashboardInterval: 7\nCoordinationKey: after\n")
+	m.reloadConfig(path, "", &loaded)
+	close(stop)
+	readers.Wait()
+
+	if got := m.cfg().DashboardInterval; got != 7 {
+		t.Errorf("DashboardInterval is %d after the reload, want 7", got)
+	}
+	if got := m.cfg().CoordinationKey; got != "before" {
+		t.Errorf("CoordinationKey is %q after the reload, want the restart-only field kept at %q", got, "before")
+	}
+	if before.DashboardInterval != 5 {
+		t.Errorf("the config read before the reload changed to DashboardInterval %d", before.DashboardInterval)
+	}
+}
+
+func TestReloadKeepsStartupOnlySyncSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(config string) {
+		if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("OptimizeTimer: 1\nSyncPollInterval: 1\n")
+	loaded, err := util.LoadConfig(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newTestManager(newFakeEngine(), []byte{0, 0})
+	running := loaded
+	m.config.Store(&running)
+
+	write("OptimizeTimer: 1\nSyncPollInterval: 3\nSyncSettleDelay:\n  Zone: 2\n")
+	m.reloadConfig(path, "", &loaded)
+	if got := m.cfg().SyncPollInterval; got != 1 {
+		t.Errorf("SyncPollInterval is %d after the reload, want the startup value 1", got)
+	}
+	if got := m.cfg().SyncSettleDelay.Zone; got != 0 {
+		t.Errorf("SyncSettleDelay.Zone is %d after the reload, want the startup value 0", got)
+	}
+
+	write("OptimizeTimer: 1\nSyncPollInterval: 0\n")
+	if _, err := util.LoadConfig(path, ""); err == nil {
+		t.Error("loaded a config with SyncPollInterval 0")
+	}
+}
+
+func TestLoadConfigRejectsZeroDashboardInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(path, []byte("Dashboard: true\nDashboardInterval: 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := util.LoadConfig(path, ""); err == nil {
+		t.Error("loaded a config with DashboardInterval 0")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/TwiN/go-color"
+)
+
+// minRestartDelay is the shortest delay before a goroutine that panicked is restarted, so that a
+// panic that recurs right away doesn't make the goroutine spin.
+const minRestartDelay = time.Second
+
+// safeGo runs fn in its own goroutine and recovers from any panic raised inside of it.
+// A panic is logged together with its stack trace and fn is restarted with exponential
+// back-off, so a fault in the handler for one chain does not take down the whole manager.
+// If fn returns normally the goroutine simply exits and is not restarted. The back-off starts
+// over once fn ran for backoffResetWindow without panicking.
+func safeGo(name string, fn func()) {
+	go func() {
+		var restarts backoff
+		for {
+			restarts.Succeed()
+			if !runRecovered(name, fn) {
+				return
+			}
+			attempts := restarts.Fail()
+
+			// exponential back-off implemented
+			delay := time.Duration(backoffDelaySecs(attempts)) * time.Second
+			if delay < minRestartDelay {
+				delay = minRestartDelay
+			}
+
+			log.Println(color.Ize(color.Red, "Restarting goroutine after panic"), "name", name, "attempt", attempts, "delay", delay)
+			time.Sleep(delay)
+		}
+	}()
+}
+
+// goRecovered runs fn in its own goroutine and recovers from a panic inside of it like safeGo,
+// without restarting it. It is meant for one-off work such as sending a single block.
+func goRecovered(name string, fn func()) {
+	go runRecovered(name, fn)
+}
+
+// withLock runs fn holding the manager lock. The lock is released even if fn panics, so that a
+// goroutine recovered by safeGo doesn't leave the manager locked; every section of code holding
+// the lock either uses withLock or defers the unlock.
+func (m *Manager) withLock(fn func()) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	fn()
+}
+
+// runRecovered calls fn and reports whether it panicked.
+func runRecovered(name string, fn func()) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = true
+			log.Println(color.Ize(color.Red, "PANIC in goroutine"), "name", name, "err", r)
+			log.Println(color.Ize(color.Red, string(debug.Stack())))
+		}
+	}()
+	fn()
+	return false
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/spruce-solutions/go-quai/common"
+	"github.com/spruce-solutions/go-quai/core/types"
+)
+
+var (
+	// sealStartCounters count the seals the mining loop started, indexed by the context whose
+	// update of the combined header caused them.
+	sealStartCounters = newContextCounters("manager/seal/starts")
+	// sealInterruptCounters count the running seals that were interrupted before finding a
+	// block, indexed by the context of the update that interrupted them.
+	sealInterruptCounters = newContextCounters("manager/seal/interrupts")
+	// sealCompletionCounters count the seals that found a block, indexed by mined context.
+	sealCompletionCounters = newContextCounters("manager/seal/completions")
+)
+
+// sealTracker follows the seal of the mining loop to tell the interrupted seals from those that
+// found a block.
+type sealTracker struct {
+	lock    sync.Mutex
+	parents []common.Hash // parents of the last header the mining loop received
+	sealing common.Hash   // seal hash of the running seal
+	running bool          // whether the seal runs and has not found a block yet
+}
+
+// Update records a new header for the mining loop and returns the context of the update, the
+// highest context whose parent changed or zone if none did. A running seal counts as
+// interrupted by it.
+func (t *sealTracker) Update(header *types.Header) int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	updated := len(contextNames) - 1
+	for i := range contextNames {
+		if len(t.parents) <= i || len(header.ParentHash) <= i || t.parents[i] != header.ParentHash[i] {
+			updated = i
+			break
+		}
+	}
+	t.parents = append(t.parents[:0], header.ParentHash...)
+	if t.running {
+		sealInterruptCounters[updated].Inc(1)
+		t.running = false
+	}
+	return updated
+}
+
+// Start records the start of the seal of the header with the seal hash for an update of the
+// context.
+func (t *sealTracker) Start(updated int, sealHash common.Hash) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	sealStartCounters[updated].Inc(1)
+	t.sealing, t.running = sealHash, true
+}
+
+// Stop records that the seal ended without finding a block or being interrupted.
+func (t *sealTracker) Stop() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.running = false
+}
+
+// Found records a block found for the seal hash in the mined context, which completes the seal
+// if it is the running one.
+func (t *sealTracker) Found(sealHash common.Hash, mined int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.running && t.sealing == sealHash {
+		sealCompletionCounters[mined].Inc(1)
+		t.running = false
+	}
+}
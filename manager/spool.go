@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spruce-solutions/go-quai/core/types"
+)
+
+// errInvalidSpooledBlock is returned for spooled blocks without a header, context or location.
+var errInvalidSpooledBlock = errors.New("invalid spooled block")
+
+const (
+	// shutdownGrace bounds how long a shutdown waits for the mined blocks being submitted.
+	shutdownGrace = 10 * time.Second
+)
+
+// spooledBlock is a mined block that was not submitted when the manager shut down, together
+// with the pending blocks whose bodies it was sealed with.
+type spooledBlock struct {
+	Context  int            `json:"context"`
+	Location []byte         `json:"location"`
+	Header   *types.Header  `json:"header"`
+	Pending  []*spooledBody `json:"pending"`
+}
+
+// spooledBody is a pending block, nil if there was none for its context.
+type spooledBody struct {
+	Header       *types.Header      `json:"header"`
+	Transactions types.Transactions `json:"transactions"`
+	Uncles       []*types.Header    `json:"uncles"`
+	Receipts     []*types.Receipt   `json:"receipts"`
+}
+
+// newSpooledBlock returns the mined header submitted for the context with the pending blocks.
+func newSpooledBlock(submitted int, header *types.Header, pending []*types.ReceiptBlock, location []byte) *spooledBlock {
+	spooled := &spooledBlock{Context: submitted, Location: location, Header: header}
+	for _, block := range pending {
+		if block == nil {
+			spooled.Pending = append(spooled.Pending, nil)
+			continue
+		}
+		spooled.Pending = append(spooled.Pending, &spooledBody{
+			Header:       block.Header(),
+			Transactions: block.Transactions(),
+			Uncles:       block.Uncles(),
+			Receipts:     block.Receipts(),
+		})
+	}
+	return spooled
+}
+
+// pendingBlocks returns the pending blocks the mined header was sealed with.
+func (s *spooledBlock) pendingBlocks() []*types.ReceiptBlock {
+	pending := make([]*types.ReceiptBlock, len(contextNames))
+	for i, body := range s.Pending {
+		if i < len(pending) && body != nil && body.Header != nil {
+			pending[i] = types.NewReceiptBlockWithHeader(body.Header).WithBody(body.Transactions, body.Uncles, body.Receipts)
+		}
+	}
+	return pending
+}
+
+// writeSpooledBlock writes the block to the spool directory, named by its hash.
+func writeSpooledBlock(dir string, spooled *spooledBlock) error {
+	data, err := json.Marshal(spooled)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, spooled.Header.Hash().Hex()+".json"), data, 0644)
+}
+
+// drainSubmissions takes the mined blocks that are queued and not yet submitted off the result
+// and submission queues and returns them with the pending blocks and location they were sealed
+// with. The result and submission loops have to be stopped first, or they race it for the blocks.
+func (m *Manager) drainSubmissions() []*spooledBlock {
+	var drained []*spooledBlock
+	spool := func(submitted int, result *minedResult) {
+		drained = append(drained, newSpooledBlock(submitted, result.Header, result.pending, result.location))
+	}
+	var unqueued []*minedResult
+	m.withLock(func() { unqueued, m.unqueued = m.unqueued, nil })
+	for _, result := range unqueued {
+		if submitted := m.submissionContext(result.Context); submitted >= 0 {
+			spool(submitted, result)
+		}
+	}
+	for len(m.resultCh) > 0 {
+		select {
+		case result := <-m.resultCh:
+			if submitted := m.submissionContext(result.Context); submitted >= 0 {
+				spool(submitted, result)
+			}
+		default:
+		}
+	}
+	for submitted, ch := range m.submitChs {
+		for len(ch) > 0 {
+			select {
+			case result := <-ch:
+				spool(submitted, result)
+			default:
+			}
+		}
+	}
+	return drained
+}
+
+// stopSubmitLoops stops the result and submission loops and waits up to the timeout for the
+// submissions in flight to finish. It reports whether they did.
+func (m *Manager) stopSubmitLoops(timeout time.Duration) bool {
+	close(m.shutdownCh)
+	stopped := make(chan struct{})
+	go func() {
+		m.submitLoops.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// spoolOnShutdown writes the mined blocks that are not submitted yet to SpoolDir when the
+// process is told to stop. The result and submission loops are stopped first and the
+// submissions in flight are given shutdownGrace to finish.
+func (m *Manager) spoolOnShutdown() {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-stop
+	log.Println("Shutting down, spooling the mined blocks not submitted yet", "signal", sig, "dir", m.cfg().SpoolDir)
+
+	if !m.stopSubmitLoops(shutdownGrace) {
+		log.Println("Abandoning mined block submissions still in flight", "count", m.submissions.Len())
+	}
+	for _, block := range m.drainSubmissions() {
+		if err := writeSpooledBlock(m.cfg().SpoolDir, block); err != nil {
+			log.Println("Failed to spool mined block", "hash", block.Header.Hash(), "err", err)
+			continue
+		}
+		log.Println("Spooled mined block", "context", contextNames[block.Context], "hash", block.Header.Hash())
+	}
+	os.Exit(0)
+}
+
+// replaySpool submits the mined blocks spooled by the previous shutdown and removes them from
+// SpoolDir. Blocks the network moved past are rejected by the nodes and only logged.
+func (m *Manager) replaySpool() {
+	files, err := ioutil.ReadDir(m.cfg().SpoolDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("Failed to read spool directory", "dir", m.cfg().SpoolDir, "err", err)
+		}
+		return
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(m.cfg().SpoolDir, file.Name())
+		data, err := ioutil.ReadFile(path)
+		var spooled spooledBlock
+		if err == nil {
+			err = json.Unmarshal(data, &spooled)
+		}
+		if err == nil && (spooled.Header == nil || spooled.Context < 0 || spooled.Context >= len(contextNames) || len(spooled.Location) != 2) {
+			err = errInvalidSpooledBlock
+		}
+		if err != nil {
+			log.Println("Skipping spooled mined block", "path", path, "err", err)
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			log.Println("Failed to remove spooled mined block, not replaying it", "path", path, "err", err)
+			continue
+		}
+		log.Println("Replaying spooled mined block", "context", contextNames[spooled.Context], "hash", spooled.Header.Hash())
+		m.submitMined(spooled.Context, spooled.Header, spooled.pendingBlocks(), spooled.Location)
+	}
+}
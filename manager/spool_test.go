@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/spruce-solutions/go-quai/common"
+	"github.com/spruce-solutions/go-quai/core/types"
+)
+
+func TestShutdownSpoolsQueuedResultsWithTheirBodies(t *testing.T) {
+	m := newTestManager(newFakeEngine(), []byte{1, 1})
+	// the manager switched since the queued blocks were sealed
+	m.pendingBlocks[2] = newTestPendingBlock(2, 20, []byte{1, 1}).block
+	sealed := newTestPendingBlock(2, 10, []byte{0, 0}).block
+	newResult := func(nonce uint64) *minedResult {
+		header := sealed.Header()
+		header.Nonce = types.EncodeNonce(nonce)
+		pending := make([]*types.ReceiptBlock, len(contextNames))
+		pending[2] = sealed
+		return &minedResult{HeaderBundle: &types.HeaderBundle{Header: header, Context: 2}, pending: pending, location: []byte{0, 0}}
+	}
+	m.resultCh <- newResult(1)
+	m.submitChs[2] <- newResult(2)
+
+	if !m.stopSubmitLoops(time.Second) {
+		t.Fatal("stopping the loops timed out")
+	}
+	// loops started after the shutdown leave the queues alone
+	stopped := make(chan struct{})
+	go func() {
+		m.resultLoop()
+		m.submitLoop(2)
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("loops kept running after the shutdown")
+	}
+
+	drained := m.drainSubmissions()
+	if len(drained) != 2 {
+		t.Fatalf("drained %d blocks, want 2", len(drained))
+	}
+	for _, spooled := range drained {
+		if !bytes.Equal(spooled.Location, []byte{0, 0}) {
+			t.Errorf("block %v spooled with location %v, want the sealed location [0 0]", spooled.Header.Nonce, spooled.Location)
+		}
+		pending := spooled.pendingBlocks()
+		if pending[2] == nil || pending[2].Header().Number[2].Int64() != 10 {
+			t.Errorf("block %v spooled without the zone body it was sealed with", spooled.Header.Nonce)
+		}
+	}
+}
+
+func TestShutdownSpoolsOfflineRetries(t *testing.T) {
+	m := newTestManager(newFakeEngine(), []byte{1, 1})
+	config := *m.cfg()
+	config.OfflineSubmitGrace = 60
+	m.config.Store(&config)
+	sealed := newTestPendingBlock(2, 10, []byte{1, 1}).block
+	pending := make([]*types.ReceiptBlock, len(contextNames))
+	pending[2] = sealed
+	result := &minedResult{HeaderBundle: &types.HeaderBundle{Header: sealed.Header(), Context: 2}, pending: pending, location: []byte{1, 1}}
+
+	// the retry is still waiting for its interval when the manager shuts down
+	m.retryOffline(result, make(map[common.Hash]time.Time))
+	if !m.stopSubmitLoops(time.Second) {
+		t.Fatal("stopping the loops timed out")
+	}
+	drained := m.drainSubmissions()
+	if len(drained) != 1 || drained[0].Header.Hash() != sealed.Header().Hash() {
+		t.Fatalf("drained %d blocks, want the retried block", len(drained))
+	}
+	if len(m.resultCh) != 0 {
+		t.Errorf("retry queued %d results after the shutdown", len(m.resultCh))
+	}
+}
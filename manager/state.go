@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spruce-solutions/quai-manager/manager/util"
+)
+
+// optimizerState is the optimizer's last decision, persisted so that a restart resumes mining
+// at the same location instead of re-scanning and possibly switching away.
+type optimizerState struct {
+	Location   []int     `json:"location"`
+	LastSwitch time.Time `json:"lastSwitch"`
+}
+
+// loadOptimizerState reads the persisted optimizer state from path.
+func loadOptimizerState(path string) (*optimizerState, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var state optimizerState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// location returns the persisted location, or nil if it isn't a valid [region, zone] pair.
+func (s *optimizerState) location() []byte {
+	if len(s.Location) != 2 || s.Location[0] < 1 || s.Location[1] < 1 {
+		return nil
+	}
+	return []byte{byte(s.Location[0]), byte(s.Location[1])}
+}
+
+// resumableOptimizerState returns the persisted optimizer state if a state file is configured,
+// can be read and holds a location the optimizer filter still allows, nil otherwise.
+func resumableOptimizerState(config util.Config) *optimizerState {
+	if config.OptimizerStateFile == "" {
+		return nil
+	}
+	state, err := loadOptimizerState(config.OptimizerStateFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("Ignoring optimizer state", "path", config.OptimizerStateFile, "err", err)
+		}
+		return nil
+	}
+	location := state.location()
+	if location == nil || !newOptimizerOptions(config).filter.allowed(int(location[0]), int(location[1])) {
+		return nil
+	}
+	return state
+}
+
+// saveOptimizerState atomically writes the optimizer state to path.
+func saveOptimizerState(path string, location []byte, lastSwitch time.Time) error {
+	state := optimizerState{LastSwitch: lastSwitch}
+	for _, loc := range location {
+		state.Location = append(state.Location, int(loc))
+	}
+	data, err := json.Marshal(&state)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// persistOptimizerState saves the optimizer state if a state file is configured.
+func persistOptimizerState(path string, location []byte, lastSwitch time.Time) {
+	if path == "" {
+		return
+	}
+	if err := saveOptimizerState(path, location, lastSwitch); err != nil {
+		log.Println("Failed to persist optimizer state", "path", path, "err", err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// submissionWindow is the period the windowed submission counts cover.
+	submissionWindow = time.Hour
+	// submissionBucket is the granularity of the windowed submission counts.
+	submissionBucket = time.Minute
+)
+
+// submissionCounts are the number of successful and failed submissions.
+type submissionCounts struct {
+	Succeeded uint64 `json:"succeeded"`
+	Failed    uint64 `json:"failed"`
+}
+
+func (c *submissionCounts) add(err error) {
+	if err != nil {
+		c.Failed++
+	} else {
+		c.Succeeded++
+	}
+}
+
+// submissionBucketCounts are the submission counts of one bucket of the window.
+type submissionBucketCounts struct {
+	start int64 // bucket index, time since epoch divided by submissionBucket
+	submissionCounts
+}
+
+// contextSubmissions is the JSON representation of the submission counts of a context.
+type contextSubmissions struct {
+	Total    submissionCounts `json:"total"`
+	LastHour submissionCounts `json:"lastHour"`
+}
+
+// submissionStats tracks per context the cumulative submission results and those within the
+// last submissionWindow.
+type submissionStats struct {
+	lock    sync.Mutex
+	total   [3]submissionCounts
+	buckets [3][]submissionBucketCounts
+}
+
+func newSubmissionStats() *submissionStats {
+	s := &submissionStats{}
+	for i := range s.buckets {
+		s.buckets[i] = make([]submissionBucketCounts, submissionWindow/submissionBucket)
+	}
+	return s
+}
+
+// Record counts the result of a submission in the given context.
+func (s *submissionStats) Record(difficultyContext int, err error) {
+	now := time.Now().UnixNano() / int64(submissionBucket)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.total[difficultyContext].add(err)
+	bucket := &s.buckets[difficultyContext][now%int64(len(s.buckets[difficultyContext]))]
+	if bucket.start != now {
+		*bucket = submissionBucketCounts{start: now}
+	}
+	bucket.add(err)
+}
+
+// status returns the submission counts keyed by context name.
+func (s *submissionStats) status() map[string]contextSubmissions {
+	now := time.Now().UnixNano() / int64(submissionBucket)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	status := make(map[string]contextSubmissions, len(contextNames))
+	for i, name := range contextNames {
+		counts := contextSubmissions{Total: s.total[i]}
+		for _, bucket := range s.buckets[i] {
+			if now-bucket.start < int64(len(s.buckets[i])) {
+				counts.LastHour.Succeeded += bucket.Succeeded
+				counts.LastHour.Failed += bucket.Failed
+			}
+		}
+		status[name] = counts
+	}
+	return status
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+
+	"github.com/spruce-solutions/quai-manager/manager/util"
+)
+
+// startupMode names how the manager was started: "manual" with the location on the command
+// line, "auto" when the optimizer selects it, "fixed" when mining the configured location and
+// "listen" when not mining.
+func startupMode(config util.Config, args []string) string {
+	switch {
+	case len(args) > 2:
+		return "manual"
+	case config.Auto && config.Mine:
+		return "auto"
+	case config.Mine:
+		return "fixed"
+	}
+	return "listen"
+}
+
+// connectedChains returns the names of the configured chains that are connected and of those
+// that are offline.
+func connectedChains(clients clientStates, hasPrime bool) ([]string, []string) {
+	var connected, offline []string
+	add := func(c chainState, location [2]byte) {
+		switch {
+		case c.available:
+			connected = append(connected, chainName(location))
+		case c.url != "":
+			offline = append(offline, chainName(location))
+		}
+	}
+	if hasPrime {
+		add(clients.prime, [2]byte{0, 0})
+	}
+	for i, region := range clients.regions {
+		add(region, [2]byte{byte(i + 1), 0})
+	}
+	for i, zones := range clients.zones {
+		for j, zone := range zones {
+			add(zone, [2]byte{byte(i + 1), byte(j + 1)})
+		}
+	}
+	return connected, offline
+}
+
+// logStartupSummary logs the configuration the manager runs with once it is initialized, so
+// that a deployment can be checked at a glance.
+func (m *Manager) logStartupSummary(mode string, changeLocationCycle bool, threads int) {
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	}
+	connected, offline := connectedChains(m.chainStates(), m.cfg().HasPrime)
+
+	optimizer := "off"
+	if changeLocationCycle {
+		optimizer = fmt.Sprintf("scope=%s timer=%dm", m.cfg().OptimizerScope, m.cfg().OptimizeTimer)
+		if m.cfg().OptimizerDifficultyDrop > 0 {
+			optimizer += fmt.Sprintf(" drop=%g", m.cfg().OptimizerDifficultyDrop)
+		}
+		if m.fleet != nil {
+			optimizer += " fleet=" + m.fleet.addr
+		}
+	} else if len(m.cfg().FailoverLocations) > 0 && m.cfg().Mine {
+		optimizer = fmt.Sprintf("failover=%v", m.cfg().FailoverLocations)
+	}
+
+	var endpoints []string
+	if m.cfg().HTTPAddr != "" {
+		endpoints = append(endpoints, "http="+m.cfg().HTTPAddr+" (/status /contexts /abort /header /metrics)")
+	}
+	if m.workQueue != nil {
+		endpoints = append(endpoints, "workqueue="+m.workQueue.addr)
+	}
+	if m.cfg().SystemdNotify {
+		endpoints = append(endpoints, "systemd")
+	}
+
+	log.Println("Startup summary",
+		"mode", mode,
+		"location", m.location,
+		"mine", m.cfg().Mine,
+		"contexts", fmt.Sprintf("prime=%t region=%t zone=%t", m.mineContexts.Enabled(0), m.mineContexts.Enabled(1), m.mineContexts.Enabled(2)),
+		"threads", threads,
+		"connected", strings.Join(connected, " "),
+		"offline", strings.Join(offline, " "),
+		"optimizer", optimizer,
+		"endpoints", strings.Join(endpoints, ", "),
+	)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/spruce-solutions/go-quai/ethclient"
+)
+
+// waitForSync blocks until the node is done syncing, logging the sync progress every interval.
+// If the node was syncing, it waits another settle period for its pending state to catch up.
+func waitForSync(client *ethclient.Client, sliceIndex int, interval time.Duration, settle time.Duration) error {
+	for syncing := false; ; syncing = true {
+		progress, err := client.SyncProgress(context.Background())
+		if err != nil {
+			log.Println("Error occured while synching to", contextNames[sliceIndex], err)
+			return err
+		}
+		if progress == nil {
+			if syncing && settle > 0 {
+				log.Println("Node synced, waiting for it to settle", "context", contextNames[sliceIndex], "delay", settle)
+				time.Sleep(settle)
+			}
+			return nil
+		}
+		log.Println("Waiting for node to sync", "context", contextNames[sliceIndex], "current", progress.CurrentBlock, "highest", progress.HighestBlock)
+		time.Sleep(interval)
+	}
+}
+
+// waitForSliceSync waits for the prime, region and zone chains being mined to finish syncing.
+// The chains are checked concurrently so that mining can begin as soon as the slowest is synced.
+func (m *Manager) waitForSliceSync() {
+	// indexed by context, nil for the chains that are not waited for
+	clients := make([]*ethclient.Client, len(contextNames))
+	for i, c := range m.activeSlice().chains {
+		// prime is waited for when it is configured, whether or not it connected yet
+		if state := m.chainState(c); (i == 0 && m.cfg().HasPrime) || (i > 0 && state.available) {
+			clients[i] = state.client
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		if client == nil {
+			continue
+		}
+		wg.Add(1)
+		client, sliceIndex := client, i
+		goRecovered("waitForSync", func() {
+			defer wg.Done()
+			waitForSync(client, sliceIndex, m.syncPollInterval(sliceIndex), m.cfg().SyncSettleDelay.Duration(sliceIndex))
+		})
+	}
+	wg.Wait()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/spruce-solutions/go-quai/core/types"
+	"github.com/spruce-solutions/go-quai/ethclient"
+)
+
+// syncPollInterval returns the interval between the sync checks of the context's node.
+func (m *Manager) syncPollInterval(sliceIndex int) time.Duration {
+	if seconds := m.cfg().ContextTimings.At(sliceIndex).SyncPollInterval; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return time.Duration(m.cfg().SyncPollInterval) * time.Second
+}
+
+// maxPendingBlockAge returns the maximum age of a pending block of the context, zero to accept
+// any.
+func (m *Manager) maxPendingBlockAge(sliceIndex int) time.Duration {
+	if seconds := m.cfg().ContextTimings.At(sliceIndex).MaxPendingBlockAge; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return time.Duration(m.cfg().MaxPendingBlockAge) * time.Second
+}
+
+// maxFetchBackoff returns the longest delay in seconds between the retries of a pending block of
+// the context that the node doesn't serve.
+func (m *Manager) maxFetchBackoff(sliceIndex int) int64 {
+	if seconds := m.cfg().ContextTimings.At(sliceIndex).MaxFetchBackoff; seconds > 0 {
+		return int64(seconds)
+	}
+	return exponentialBackoffCeilingSecs
+}
+
+// requestPendingBlock requests the pending block of the context from its node, within the
+// context's FetchTimeout if one is set. The template can't be built from the head instead, its
+// state root, difficulty, base fee and gas limit follow from executing the block.
+func (m *Manager) requestPendingBlock(client *ethclient.Client, sliceIndex int) (*types.ReceiptBlock, error) {
+	ctx := context.Background()
+	if timeout := m.cfg().ContextTimings.At(sliceIndex).FetchTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
+		defer cancel()
+	}
+	return client.GetPendingBlock(ctx)
+}
@@ -2,10 +2,107 @@ package util
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
+// MineContexts selects the contexts for which mined blocks are submitted.
+type MineContexts struct {
+	Prime  bool
+	Region bool
+	Zone   bool
+}
+
+// MinedBlockEncoding selects how the transactions of a mined block are encoded when it is
+// submitted with quai_sendMinedBlock. InclTx includes the transactions at all, FullTx sends
+// the full transaction objects instead of only their hashes.
+type MinedBlockEncoding struct {
+	InclTx bool
+	FullTx bool
+}
+
+// MinedBlockEncodings holds the mined block encoding of each context.
+type MinedBlockEncodings struct {
+	Prime  MinedBlockEncoding
+	Region MinedBlockEncoding
+	Zone   MinedBlockEncoding
+}
+
+// ContextSeconds is a number of seconds for each context.
+type ContextSeconds struct {
+	Prime  int
+	Region int
+	Zone   int
+}
+
+// Duration returns the duration of the context.
+func (c ContextSeconds) Duration(sliceIndex int) time.Duration {
+	return time.Duration([]int{c.Prime, c.Region, c.Zone}[sliceIndex]) * time.Second
+}
+
+// ContextCounts is a count for each context.
+type ContextCounts struct {
+	Prime  int
+	Region int
+	Zone   int
+}
+
+// At returns the count of the context.
+func (c ContextCounts) At(sliceIndex int) int {
+	return []int{c.Prime, c.Region, c.Zone}[sliceIndex]
+}
+
+// ContextTiming are the fetch and subscription timings of one context. Zero values fall back to
+// the global setting or the default.
+type ContextTiming struct {
+	// SyncPollInterval is the number of seconds between sync status checks of the context's
+	// node, overriding the global SyncPollInterval.
+	SyncPollInterval int
+	// FetchTimeout is the number of milliseconds a pending block request may take before it is
+	// retried. Zero waits for the node.
+	FetchTimeout int
+	// MaxFetchBackoff is the maximum number of seconds between the retries of a pending block
+	// the node doesn't serve, four hours by default.
+	MaxFetchBackoff int
+	// MaxPendingBlockAge overrides the global MaxPendingBlockAge for the context.
+	MaxPendingBlockAge int
+}
+
+// ContextTimings holds the timings of each context.
+type ContextTimings struct {
+	Prime  ContextTiming
+	Region ContextTiming
+	Zone   ContextTiming
+}
+
+// At returns the timings of the context.
+func (c ContextTimings) At(sliceIndex int) ContextTiming {
+	return []ContextTiming{c.Prime, c.Region, c.Zone}[sliceIndex]
+}
+
+// CoinbaseWeight is a coinbase address and its share of the mined blocks.
+type CoinbaseWeight struct {
+	Address string
+	Weight  int
+}
+
+// Coinbases are the weighted coinbase addresses per context.
+type Coinbases struct {
+	Prime  []CoinbaseWeight
+	Region []CoinbaseWeight
+	Zone   []CoinbaseWeight
+}
+
+// ChainOverrides select the chains mined for the region and zone contexts instead of the region
+// and zone of the location, for relay topologies the location can't express.
+type ChainOverrides struct {
+	Region int   // region number of the region chain, 0 for the region of the location
+	Zone   []int // [region, zone] of the zone chain, empty for the zone of the location
+}
+
 type Config struct {
 	PrimeURL      string
 	RegionURLs    []string
@@ -15,20 +112,378 @@ type Config struct {
 	Mine          bool
 	Optimize      bool
 	OptimizeTimer int
+	// OptimizerIncludeZones limits the optimizer to these [region, zone] locations if not empty.
+	OptimizerIncludeZones [][]int
+	// OptimizerExcludeZones are [region, zone] locations the optimizer never selects.
+	OptimizerExcludeZones [][]int
+	// OptimizerUnreachable is how the optimizer treats chains it can't reach while scanning:
+	// "skip" them, "retry" them OptimizerRetries times first, or count them as "max" difficulty.
+	OptimizerUnreachable string
+	// OptimizerRetries is the number of retries for unreachable chains with "retry".
+	OptimizerRetries int
+	// OptimizerGasTiebreak is the relative difficulty margin within which the optimizer prefers
+	// the zone producing fuller blocks over the easiest one, e.g. 0.05 for 5%. Zero disables it.
+	OptimizerGasTiebreak float64
+	// OptimizerDifficultyDrop is the relative margin, e.g. 0.2 for 20%, by which a zone's
+	// difficulty must drop below the mined zone's to trigger an optimizer check right away
+	// instead of at the next OptimizeTimer tick. Zero disables it.
+	OptimizerDifficultyDrop float64
+	// OptimizerScope is how the optimizer compares zones: "region" picks the easiest region and
+	// then its easiest zone, "network" compares the zones of all regions by the expected reward
+	// per hash of mining them together with their region.
+	OptimizerScope string
+	// OptimizerRegionReward is the reward of a region block relative to a zone block, used to
+	// weigh the region difficulty with the "network" scope.
+	OptimizerRegionReward float64
+	// OptimizerRegionMargin is the relative margin, e.g. 0.1 for 10%, by which another region
+	// must be easier than the mined one for the optimizer to switch regions. Zero disables it.
+	OptimizerRegionMargin float64
+	// OptimizerStateFile is where the optimizer persists its last location selection so that
+	// auto mode resumes there after a restart. Empty disables persistence.
+	OptimizerStateFile string
+	// OptimizerConnection scans every region and zone through a connection of its own instead of
+	// the one the manager mines through.
+	OptimizerConnection bool
+	// OptimizerScanSpacing is the number of milliseconds between the requests of the optimizer's
+	// scan. Zero sends them back to back.
+	OptimizerScanSpacing int
+	// DiscardStalePendingBlocks drops pending blocks that were fetched for a location other
+	// than the one currently being mined.
+	DiscardStalePendingBlocks bool
+	// DedupPendingBlocks skips pending blocks with the same number, state root and transactions
+	// as the last one of their context, so that they don't interrupt the seal.
+	DedupPendingBlocks bool
+	// ReceiptCacheSize is the number of receipt blocks cached by block hash, 0 disables the cache.
+	ReceiptCacheSize int
+	// ReceiptCacheTTL is the number of seconds a cached receipt block stays valid.
+	ReceiptCacheTTL int
+	// CacheMemoryBudget is the approximate number of megabytes the caches may hold together,
+	// the oldest entries are evicted beyond it. 0 leaves only the entry counts as a bound.
+	CacheMemoryBudget int
+	// MaxStaleRefetches is how many times a pending block that is older than the one being mined
+	// is refetched before it is used anyway.
+	MaxStaleRefetches int
+	// VerifyPendingParent refetches pending blocks whose parent is not the head of the node, up
+	// to MaxStaleRefetches times, and drops them if it still isn't. It costs a request per fetch.
+	VerifyPendingParent bool
+	// MaxPendingBlockAge is the maximum age in seconds of a pending block's timestamp for it to be
+	// mined. 0 disables the check.
+	MaxPendingBlockAge int
+	// WorkQueueURL is the redis://host:port URL of the message queue combined headers are
+	// published to for external hashers. Empty disables publishing.
+	WorkQueueURL string
+	// WorkQueueChannel is the channel work packages are published on.
+	WorkQueueChannel string
+	// SolutionQueueChannel is the channel solutions from external hashers are read from.
+	SolutionQueueChannel string
+	// CoordinationURL is the redis://host:port URL of the store the managers of a fleet share
+	// their locations through. Empty selects locations without regard to other managers.
+	CoordinationURL string
+	// CoordinationKey is the prefix of the keys the locations are stored under.
+	CoordinationKey string
+	// CoordinationID identifies the manager in the store, the host name and process ID if empty.
+	CoordinationID string
+	// CoordinationTTL is the number of seconds after which the location of a manager that
+	// stopped refreshing it expires.
+	CoordinationTTL int
+	// Dashboard enables a periodic single line summary of the mining state.
+	Dashboard bool
+	// DashboardInterval is the number of seconds between dashboard lines.
+	DashboardInterval int
+	// SyncPollInterval is the number of seconds between sync status checks while a node syncs.
+	SyncPollInterval int
+	// SyncSettleDelay is the number of seconds to wait per context after a node finished syncing
+	// before its pending blocks are mined.
+	SyncSettleDelay ContextSeconds
+	// VerifyExternalBlocks confirms that relayed external blocks were stored by the receiving node.
+	VerifyExternalBlocks bool
+	// ExternalBlockResends bounds how often an external block that was not stored is resent.
+	ExternalBlockResends int
+	// RelayWorkers is the number of external block sends that run concurrently.
+	RelayWorkers int
+	// RelayPoolSizes is the number of connections per context that external blocks are relayed
+	// to a chain through, round-robin.
+	RelayPoolSizes ContextCounts
+	// CompressedChains are the [region, zone] locations, [0, 0] for prime and [region, 0] for
+	// a region, of the chains whose websocket connections offer compression, e.g. for nodes
+	// across a WAN link.
+	CompressedChains [][]int
+	// BackfillMinedNumbers takes the number of the context a mined block is submitted for from
+	// its pending block when the mined header lacks it, if the seal still meets the difficulty.
+	BackfillMinedNumbers bool
+	// ResubmitRejectedBlocks resends the external blocks to a node that rejected a mined block
+	// for an unknown ancestor or a missing external block and submits the block once more.
+	ResubmitRejectedBlocks bool
+	// ReportZeroHashrate logs and records the local hashrate even when it is zero. The zone node
+	// is sent the hashrate every minute either way.
+	ReportZeroHashrate bool
+	// FailoverLocations are the [region, zone] locations mined, in order, while the configured
+	// Location is unreachable. Only used when the optimizer does not select the location.
+	FailoverLocations [][]int
+	// LogSubmissionTargets logs every mined and external block send with the URL of the node it
+	// went to. Failed sends are always logged with the URL.
+	LogSubmissionTargets bool
+	// ReactiveExternalRelayOnly relays external blocks only to the chains the block is mined for
+	// and to chains that report it missing, instead of broadcasting it to every chain.
+	ReactiveExternalRelayOnly bool
+	// MineContexts are the contexts mined blocks are submitted for, they can be toggled at runtime.
+	MineContexts MineContexts
+	// HTTPAddr is the listen address of the status and control endpoints. Empty disables them.
+	HTTPAddr string
+	// Coinbases distributes mined blocks of each context across weighted addresses. Contexts
+	// without addresses keep the coinbase of the node's pending block.
+	Coinbases Coinbases
+	// ExtraData tags the headers of mined blocks, as a 0x prefixed hex value or a plain string
+	// of at most 32 bytes. Empty keeps the extra data of the node's pending block.
+	ExtraData string
+	// UserAgent is sent as the User-Agent of HTTP and websocket connections to the nodes. Empty
+	// keeps the default of the Go HTTP client.
+	UserAgent string
+	// HasPrime is false on networks without a prime chain, the manager then mines region and
+	// zone blocks only and PrimeURL is ignored.
+	HasPrime bool
+	// RequireAllChains waits for every configured chain to be online before starting. If false
+	// the manager starts once the slice it mines is online and connects the others later.
+	RequireAllChains bool
+	// VerifyNodeIdentities checks on startup that every node reports the chain ID of prime and
+	// blocks of the location its URL is configured for.
+	VerifyNodeIdentities bool
+	// MaxClockSkew is the number of seconds the local clock may differ from the newest block of
+	// the connected chains before the manager warns on startup, 0 disables the check.
+	MaxClockSkew int
+	// RefuseClockSkew exits instead of warning when the clock is skewed by more than MaxClockSkew.
+	RefuseClockSkew bool
+	// AcceptanceDepth is the number of heads after which a submitted block must be canonical
+	// before it is reported as not accepted. Zero disables the check.
+	AcceptanceDepth int
+	// AlertWebhook is a URL blocks that were not accepted are posted to. Empty only logs them.
+	AlertWebhook string
+	// MinSealDuration is the number of milliseconds a seal runs before a header update may
+	// interrupt it. Updates arriving sooner are coalesced and the latest one is mined afterwards.
+	MinSealDuration int
+	// MinedBlockEncodings selects per context how the transactions of mined and sealed blocks
+	// are sent to the nodes.
+	MinedBlockEncodings MinedBlockEncodings
+	// MissingExternalDedupWindow is the number of milliseconds a missing external block request
+	// is ignored for after the same block was sent to the requesting chain, 0 answers every one.
+	MissingExternalDedupWindow int
+	// ExternalBatchWindow is the number of milliseconds external blocks sent to the same chain
+	// are collected for before they are sent in a single batch. Zero sends them individually.
+	ExternalBatchWindow int
+	// ExternalBatchSize is the number of external blocks after which a batch is sent before its
+	// window has passed.
+	ExternalBatchSize int
+	// SystemdNotify signals readiness and sends watchdog pings to systemd when the manager runs
+	// as a Type=notify service.
+	SystemdNotify bool
+	// OfflineSubmitGrace is the number of seconds a mined block is retried for while one of
+	// the chains is offline before it is dropped. Zero drops it right away.
+	OfflineSubmitGrace int
+	// SpoolDir is the directory the mined blocks not submitted yet are written to when the
+	// manager is stopped, and replayed from when it starts mining. Empty disables the spool.
+	SpoolDir string
+	// PrimeBackupURLs are further prime node URLs, switched to in order when the prime node in
+	// use stops answering.
+	PrimeBackupURLs []string
+	// MinRewardPerHash is the expected reward per hash, in zone block rewards, below which the
+	// miner idles until it rises again. Zero disables the economic gate.
+	MinRewardPerHash float64
+	// InitialFetchTimeout is the number of seconds mining waits for the initial pending blocks
+	// of the mined slice before it starts without the missing ones. Zero waits indefinitely.
+	InitialFetchTimeout int
+	// NonceReuseWindow is the number of seconds the nonces of found seals are remembered to warn
+	// when the engine finds the same nonce for the same seal hash again.
+	NonceReuseWindow int
+	// NonceLogFile is a file the nonce of every found seal is appended to as a JSON line. Empty
+	// only logs them.
+	NonceLogFile string
+	// ContextTimings are per context overrides of the pending block fetch and sync timings, e.g.
+	// for a remote prime node with a higher latency than the local zones.
+	ContextTimings ContextTimings
+	// ProofDir is the directory a proof of every mined block is written to, for verification
+	// with the verify-proof command. Empty writes none.
+	ProofDir string
+	// QueueDiagnosticInterval is the number of seconds between the logs of the queue depths. 0
+	// disables them.
+	QueueDiagnosticInterval int
+	// ChainOverrides select other chains than those of the location for the region and zone
+	// contexts. Empty mines the chains of the location.
+	ChainOverrides ChainOverrides
+	// PendingPollInterval is the number of milliseconds between pending block fetches from nodes
+	// that don't support pending block subscriptions. 0 stops the manager on such nodes instead.
+	PendingPollInterval int
+	// MinedGapAlert is the multiple of the expected time to mine a block of a context, from the
+	// hashrate and difficulty, after which a context without a mined block is alerted. 0
+	// disables the alert.
+	MinedGapAlert float64
+	// ArchiveDir is a directory every mined block is archived to with its body and receipts.
+	// Empty archives none to a directory.
+	ArchiveDir string
+	// ArchiveURL is a URL every mined block is PUT under with its body and receipts, e.g. an
+	// S3-compatible bucket. Empty uploads none.
+	ArchiveURL string
+	// ArchiveQueueSize is the number of mined blocks waiting to be archived past which further
+	// blocks are not archived.
+	ArchiveQueueSize int
+	// MaxRelaySyncLag is the number of blocks a chain's node may be behind while syncing before
+	// external blocks are no longer relayed to it. 0 relays to every chain.
+	MaxRelaySyncLag int
+	// VerifyExternalReceipts checks that the receipts fetched for a block to relay as an external
+	// block are the block's, refetching them once before skipping the block.
+	VerifyExternalReceipts bool
+	// InitialLocation is the [region, zone] location an auto-miner without a resumable optimizer
+	// state mines at while its first scan runs. Empty scans before mining.
+	InitialLocation []int
+	// InitialLocationMargin is the relative margin, e.g. 0.1 for 10%, by which the location found
+	// by the first scan must be easier than InitialLocation for the auto-miner to switch to it.
+	InitialLocationMargin float64
+	// CoalesceNewHeads processes only the latest of the new heads of a chain that arrived while
+	// the previous one was processed.
+	CoalesceNewHeads bool
+	// BackoffResetWindow is the number of seconds a connection, pending block fetch or goroutine
+	// must work without failing for its exponential back-off to start over. 0 never starts over.
+	BackoffResetWindow int
 }
 
-// LoadConfig reads configuration from file or environment variables.
-func LoadConfig(path string) (config Config, err error) {
-	viper.AddConfigPath("./config")
-	viper.SetConfigName("config") // name of config file (without extension)
-	viper.SetConfigType("yaml")   // REQUIRED if the config file does not have the extension in the name
-	viper.AddConfigPath(".")      // optionally look for config in the working directory
-	err = viper.ReadInConfig()    // Find and read the config file
+// LoadConfig reads configuration from file or environment variables. If path is empty the
+// config.yaml file is looked up in the default locations. If a profile is given, the file
+// <name>.<profile>.<ext> next to the base config file is merged on top of it.
+func LoadConfig(path string, profile string) (config Config, err error) {
+	// start from a clean viper so that the config can be loaded again at runtime
+	viper.Reset()
+	viper.SetDefault("OptimizerUnreachable", "skip")
+	viper.SetDefault("OptimizerRetries", 2)
+	viper.SetDefault("OptimizerGasTiebreak", 0)
+	viper.SetDefault("OptimizerDifficultyDrop", 0)
+	viper.SetDefault("OptimizerScope", "region")
+	viper.SetDefault("OptimizerRegionReward", 1)
+	viper.SetDefault("OptimizerRegionMargin", 0)
+	viper.SetDefault("OptimizerStateFile", "")
+	viper.SetDefault("OptimizerConnection", false)
+	viper.SetDefault("OptimizerScanSpacing", 0)
+	viper.SetDefault("DiscardStalePendingBlocks", true)
+	viper.SetDefault("DedupPendingBlocks", true)
+	viper.SetDefault("ReceiptCacheSize", 256)
+	viper.SetDefault("ReceiptCacheTTL", 60)
+	viper.SetDefault("CacheMemoryBudget", 0)
+	viper.SetDefault("MaxStaleRefetches", 1)
+	viper.SetDefault("VerifyPendingParent", false)
+	viper.SetDefault("WorkQueueChannel", "quai-manager/work")
+	viper.SetDefault("SolutionQueueChannel", "quai-manager/solutions")
+	viper.SetDefault("CoordinationURL", "")
+	viper.SetDefault("CoordinationKey", "quai-manager/locations")
+	viper.SetDefault("CoordinationID", "")
+	viper.SetDefault("CoordinationTTL", 300)
+	viper.SetDefault("DashboardInterval", 60)
+	viper.SetDefault("SyncPollInterval", 1)
+	viper.SetDefault("SyncSettleDelay.Prime", 0)
+	viper.SetDefault("SyncSettleDelay.Region", 0)
+	viper.SetDefault("SyncSettleDelay.Zone", 0)
+	viper.SetDefault("ExternalBlockResends", 3)
+	viper.SetDefault("RelayWorkers", 4)
+	viper.SetDefault("RelayPoolSizes.Prime", 1)
+	viper.SetDefault("RelayPoolSizes.Region", 1)
+	viper.SetDefault("RelayPoolSizes.Zone", 1)
+	viper.SetDefault("CompressedChains", [][]int{})
+	viper.SetDefault("FailoverLocations", [][]int{})
+	viper.SetDefault("BackfillMinedNumbers", false)
+	viper.SetDefault("ResubmitRejectedBlocks", true)
+	viper.SetDefault("ReportZeroHashrate", false)
+	viper.SetDefault("LogSubmissionTargets", false)
+	viper.SetDefault("ReactiveExternalRelayOnly", false)
+	viper.SetDefault("MineContexts.Prime", true)
+	viper.SetDefault("MineContexts.Region", true)
+	viper.SetDefault("MineContexts.Zone", true)
+	viper.SetDefault("ExtraData", "")
+	viper.SetDefault("UserAgent", "")
+	viper.SetDefault("HasPrime", true)
+	viper.SetDefault("RequireAllChains", true)
+	viper.SetDefault("VerifyNodeIdentities", false)
+	viper.SetDefault("MaxClockSkew", 60)
+	viper.SetDefault("RefuseClockSkew", false)
+	viper.SetDefault("AcceptanceDepth", 5)
+	viper.SetDefault("AlertWebhook", "")
+	viper.SetDefault("MinSealDuration", 100)
+	for _, context := range []string{"Prime", "Region", "Zone"} {
+		viper.SetDefault("MinedBlockEncodings."+context+".InclTx", true)
+		viper.SetDefault("MinedBlockEncodings."+context+".FullTx", true)
+	}
+	viper.SetDefault("MissingExternalDedupWindow", 2000)
+	viper.SetDefault("ExternalBatchWindow", 0)
+	viper.SetDefault("ExternalBatchSize", 16)
+	viper.SetDefault("SystemdNotify", false)
+	viper.SetDefault("OfflineSubmitGrace", 10)
+	viper.SetDefault("SpoolDir", "")
+	viper.SetDefault("PrimeBackupURLs", []string{})
+	viper.SetDefault("MinRewardPerHash", 0)
+	viper.SetDefault("InitialFetchTimeout", 60)
+	viper.SetDefault("NonceReuseWindow", 600)
+	viper.SetDefault("NonceLogFile", "")
+	viper.SetDefault("ProofDir", "")
+	viper.SetDefault("QueueDiagnosticInterval", 300)
+	viper.SetDefault("ChainOverrides.Region", 0)
+	viper.SetDefault("ChainOverrides.Zone", []int{})
+	viper.SetDefault("PendingPollInterval", 1000)
+	viper.SetDefault("MinedGapAlert", 0)
+	viper.SetDefault("ArchiveDir", "")
+	viper.SetDefault("ArchiveURL", "")
+	viper.SetDefault("ArchiveQueueSize", 64)
+	viper.SetDefault("MaxRelaySyncLag", 0)
+	viper.SetDefault("VerifyExternalReceipts", false)
+	viper.SetDefault("InitialLocation", []int{})
+	viper.SetDefault("InitialLocationMargin", 0.1)
+	viper.SetDefault("CoalesceNewHeads", false)
+	viper.SetDefault("BackoffResetWindow", 300)
+	viper.SetDefault("ContextTimings.Prime.SyncPollInterval", 0)
+	viper.SetDefault("ContextTimings.Prime.FetchTimeout", 0)
+	viper.SetDefault("ContextTimings.Prime.MaxFetchBackoff", 0)
+	viper.SetDefault("ContextTimings.Prime.MaxPendingBlockAge", 0)
+	viper.SetDefault("ContextTimings.Region.SyncPollInterval", 0)
+	viper.SetDefault("ContextTimings.Region.FetchTimeout", 0)
+	viper.SetDefault("ContextTimings.Region.MaxFetchBackoff", 0)
+	viper.SetDefault("ContextTimings.Region.MaxPendingBlockAge", 0)
+	viper.SetDefault("ContextTimings.Zone.SyncPollInterval", 0)
+	viper.SetDefault("ContextTimings.Zone.FetchTimeout", 0)
+	viper.SetDefault("ContextTimings.Zone.MaxFetchBackoff", 0)
+	viper.SetDefault("ContextTimings.Zone.MaxPendingBlockAge", 0)
+
+	if path != "" {
+		viper.SetConfigFile(path)
+	} else {
+		viper.AddConfigPath("./config")
+		viper.SetConfigName("config") // name of config file (without extension)
+		viper.SetConfigType("yaml")   // REQUIRED if the config file does not have the extension in the name
+		viper.AddConfigPath(".")      // optionally look for config in the working directory
+	}
+	err = viper.ReadInConfig() // Find and read the config file
 
 	if err != nil { // Handle errors reading the config file
-		panic(fmt.Errorf("Fatal error config file: %w \n", err))
+		return config, fmt.Errorf("cannot read config file: %w", err)
 	}
 
-	err = viper.Unmarshal(&config)
+	if profile != "" {
+		base := viper.ConfigFileUsed()
+		ext := filepath.Ext(base)
+		viper.SetConfigFile(strings.TrimSuffix(base, ext) + "." + profile + ext)
+		if err = viper.MergeInConfig(); err != nil {
+			return config, fmt.Errorf("cannot load profile %s: %w", profile, err)
+		}
+	}
+
+	if err = viper.Unmarshal(&config); err != nil {
+		return config, err
+	}
+	err = config.validate()
 	return
 }
+
+// validate rejects values the manager can't run with.
+func (c Config) validate() error {
+	if c.SyncPollInterval <= 0 {
+		return fmt.Errorf("SyncPollInterval must be positive, got %d", c.SyncPollInterval)
+	}
+	if c.DashboardInterval <= 0 {
+		return fmt.Errorf("DashboardInterval must be positive, got %d", c.DashboardInterval)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package util
+
+import (
+	"net/url"
+	"reflect"
+
+	"gopkg.in/yaml.v2"
+)
+
+// redacted replaces credentials in dumped config values.
+const redacted = "REDACTED"
+
+// Dump returns the config as yaml using the keys of config.yaml. Credentials embedded in URLs
+// are redacted.
+func (c Config) Dump() ([]byte, error) {
+	return yaml.Marshal(dumpValue(reflect.ValueOf(c)))
+}
+
+// dumpValue converts a config value into a form that marshals to yaml with the field names
+// and order of the config struct.
+func dumpValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Struct:
+		fields := yaml.MapSlice{}
+		for i := 0; i < v.NumField(); i++ {
+			fields = append(fields, yaml.MapItem{Key: v.Type().Field(i).Name, Value: dumpValue(v.Field(i))})
+		}
+		return fields
+	case reflect.Slice:
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			if v.Type().Elem().Kind() == reflect.Uint8 {
+				items[i] = int(v.Index(i).Uint())
+			} else {
+				items[i] = dumpValue(v.Index(i))
+			}
+		}
+		return items
+	case reflect.String:
+		return RedactURL(v.String())
+	}
+	return v.Interface()
+}
+
+// RedactURL replaces the user info of a URL, leaving any other string untouched.
+func RedactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	} else {
+		u.User = url.User(redacted)
+	}
+	return u.String()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"math"
+	"time"
+
+	"github.com/spruce-solutions/quai-manager/manager/util"
+)
+
+// initialLocation returns the InitialLocation the auto-miner starts at before its first scan,
+// nil if none is set or it is not a connected location the optimizer filter allows.
+func initialLocation(config util.Config, clients orderedBlockClients) []byte {
+	if len(config.InitialLocation) == 0 {
+		return nil
+	}
+	initial := config.InitialLocation
+	if len(initial) != 2 || initial[0] < 1 || initial[0] > 255 || initial[1] < 1 || initial[1] > 255 {
+		log.Println("Ignoring initial location, it must be a [region, zone] pair", "location", initial)
+		return nil
+	}
+	location := []byte{byte(initial[0]), byte(initial[1])}
+	if err := clients.checkZone(location); err != nil {
+		log.Println("Ignoring initial location", "err", err)
+		return nil
+	}
+	if !newOptimizerOptions(config).filter.allowed(initial[0], initial[1]) {
+		log.Println("Ignoring initial location not allowed by the optimizer zones", "location", initial)
+		return nil
+	}
+	return location
+}
+
+// warmStartScan runs the first optimizer scan of an auto-miner that started mining at its
+// initial location. It switches to the selected location only if that is easier by more than
+// InitialLocationMargin, otherwise the initial location counts as selected.
+func (m *Manager) warmStartScan() {
+	current := m.currentLocation()
+
+	options := m.fleet.withPeers(newOptimizerOptions(*m.cfg()))
+	options.gasUsed = m.gasUsed
+	options.currentRegion, options.currentZone = int(current[0]), int(current[1])
+	options.regionMargin = math.Max(options.regionMargin, m.cfg().InitialLocationMargin)
+	options.zoneMargin = m.cfg().InitialLocationMargin
+	newLocation, err := findBestLocation(m.chainStates(), options)
+	if err != nil {
+		log.Println("Keeping initial location, first scan failed", "location", current, "err", err)
+		return
+	}
+	if bytes.Equal(newLocation, current) {
+		log.Println("First scan kept the initial location", "location", current)
+		m.lastSwitch = time.Now()
+	} else {
+		log.Println("First scan found a better location than the initial one", "location", newLocation, "initial", current)
+		m.switchLocation(newLocation)
+	}
+	persistOptimizerState(m.cfg().OptimizerStateFile, newLocation, m.lastSwitch)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/spruce-solutions/go-quai/consensus/blake3"
+	"github.com/spruce-solutions/go-quai/core/types"
+	"github.com/spruce-solutions/quai-manager/manager/util"
+)
+
+// runWorker is the worker command. Instead of assembling the combined header from the nodes, the
+// manager receives the work packages a coordinator publishes on WorkQueueChannel, mines them
+// with the miningLoop and publishes the solutions on SolutionQueueChannel for the coordinator to
+// submit. It connects to no node.
+func runWorker(config util.Config) {
+	if config.WorkQueueURL == "" {
+		log.Fatal("The worker needs the WorkQueueURL of its coordinator")
+	}
+	workQueue, err := newWorkQueue(config.WorkQueueURL, config.WorkQueueChannel, config.SolutionQueueChannel)
+	if err != nil {
+		log.Fatal("Failed to create work queue: ", err)
+	}
+	engine, err := blake3.New(blake3.Config{NotifyFull: true}, nil, false)
+	if err != nil {
+		log.Fatal("Failed to create Blake3 engine: ", err)
+	}
+
+	m := &Manager{
+		engine:         engine,
+		combinedHeader: &types.Header{Number: make([]*big.Int, 3)},
+		updatedCh:      make(chan *types.Header, resultQueueSize),
+		resultCh:       make(chan *minedResult, resultQueueSize),
+		workQueue:      workQueue,
+	}
+	m.config.Store(&config)
+	log.Println("Starting worker", "queue", config.WorkQueueURL, "work", config.WorkQueueChannel, "solutions", config.SolutionQueueChannel)
+	safeGo("miningLoop", func() { m.miningLoop() })
+	safeGo("publishSolutions", func() { m.publishSolutions() })
+	for {
+		if err := m.workQueue.subscribe(m.workQueue.workChannel, m.handleWork); err != nil {
+			log.Println("Work queue subscription lost, reconnecting", "addr", m.workQueue.addr, "err", err)
+		}
+		time.Sleep(workQueueTimeout)
+	}
+}
+
+// handleWork hands the header of a work package from the coordinator to the miner.
+func (m *Manager) handleWork(payload string) {
+	var work workPackage
+	if err := json.Unmarshal([]byte(payload), &work); err != nil || work.Header == nil {
+		log.Println("Invalid work received from work queue", "err", err)
+		return
+	}
+	// the seal hash covers the whole header, a package that doesn't match has been altered
+	if hash := m.workHash(work.Header); hash != work.WorkHash {
+		log.Println("Discarding work with a mismatched work hash", "workHash", work.WorkHash, "computed", hash)
+		return
+	}
+	m.withLock(func() { m.combinedHeader = work.Header })
+	m.notifyMiner(work.Header, 2)
+}
+
+// publishSolutions publishes the nonces the miner finds to the coordinator.
+func (m *Manager) publishSolutions() {
+	for bundle := range m.resultCh {
+		solution := &workSolution{WorkHash: m.workHash(bundle.Header), Nonce: bundle.Header.Nonce}
+		if err := m.workQueue.PublishSolution(solution); err != nil {
+			log.Println("Failed to publish solution to queue", "workHash", solution.WorkHash, "err", err)
+			continue
+		}
+		log.Println("Published solution", "context", contextNames[bundle.Context], "workHash", solution.WorkHash, "nonce", solution.Nonce)
+	}
+}
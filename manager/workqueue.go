@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/spruce-solutions/go-quai/common"
+	"github.com/spruce-solutions/go-quai/common/hexutil"
+	"github.com/spruce-solutions/go-quai/core/types"
+)
+
+const (
+	// workQueueTimeout bounds every network operation against the message queue.
+	workQueueTimeout = 5 * time.Second
+	// workQueueHistory is the number of published work packages solutions are accepted for.
+	workQueueHistory = 64
+	// workQueueBacklog is the number of work packages waiting to be published.
+	workQueueBacklog = 16
+)
+
+var big2e256 = new(big.Int).Exp(big.NewInt(2), big.NewInt(256), nil)
+
+// workPackage is the unit of work published to external hashers. The hashers iterate the nonce
+// of Header and report back any nonce whose seal hash meets one of the Targets.
+type workPackage struct {
+	WorkHash common.Hash    `json:"workHash"`
+	Header   *types.Header  `json:"header"`
+	Targets  []*hexutil.Big `json:"targets"`
+}
+
+// workSolution is a nonce found by an external hasher for a previously published work package.
+type workSolution struct {
+	WorkHash common.Hash      `json:"workHash"`
+	Nonce    types.BlockNonce `json:"nonce"`
+}
+
+// queuedWork is a combined header for the work queue with the bodies of the pending blocks and
+// the location it was assembled from, which the solutions for it are submitted with.
+type queuedWork struct {
+	header   *types.Header
+	pending  []*types.ReceiptBlock
+	location []byte
+}
+
+// workQueue fans combined headers out to a fleet of hashers over Redis pub/sub and accepts
+// their solutions back.
+type workQueue struct {
+	addr            string
+	workChannel     string
+	solutionChannel string
+
+	lock    sync.Mutex
+	conn    net.Conn
+	reader  *bufio.Reader
+	history *lru.Cache       // work hash -> *queuedWork
+	work    chan *queuedWork // work packages waiting to be published
+}
+
+// newWorkQueue creates a work queue for the redis://host:port URL.
+func newWorkQueue(rawURL string, workChannel string, solutionChannel string) (*workQueue, error) {
+	addr, err := parseRedisURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	history, err := lru.New(workQueueHistory)
+	if err != nil {
+		return nil, err
+	}
+	return &workQueue{addr: addr, workChannel: workChannel, solutionChannel: solutionChannel, history: history, work: make(chan *queuedWork, workQueueBacklog)}, nil
+}
+
+// parseRedisURL returns the host:port address of a redis://host:port URL.
+func parseRedisURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "redis" || u.Host == "" {
+		return "", fmt.Errorf("unsupported redis url %q", rawURL)
+	}
+	return u.Host, nil
+}
+
+// workHash identifies the work of a header independently of its nonce.
+func (m *Manager) workHash(header *types.Header) common.Hash {
+	work := types.CopyHeader(header)
+	work.Nonce = types.BlockNonce{}
+	return m.engine.SealHash(work)
+}
+
+// PublishWork publishes the header of the work as a work package on the work channel.
+func (q *workQueue) PublishWork(hash common.Hash, work *queuedWork) error {
+	header := work.header
+	targets := make([]*hexutil.Big, len(header.Difficulty))
+	for i, difficulty := range header.Difficulty {
+		if difficulty != nil && difficulty.Sign() > 0 {
+			targets[i] = (*hexutil.Big)(new(big.Int).Div(big2e256, difficulty))
+		}
+	}
+	payload, err := json.Marshal(&workPackage{WorkHash: hash, Header: header, Targets: targets})
+	if err != nil {
+		return err
+	}
+	q.history.Add(hash, work)
+	return q.publish(q.workChannel, payload)
+}
+
+// Enqueue queues the work to be published by publishLoop. The hashers only need the latest
+// work, if the queue is full the oldest package waiting is dropped for it.
+func (q *workQueue) Enqueue(work *queuedWork) {
+	for {
+		select {
+		case q.work <- work:
+			return
+		default:
+		}
+		select {
+		case <-q.work:
+		default:
+		}
+	}
+}
+
+// publishLoop publishes the queued work packages, so that the loop merging the pending blocks
+// doesn't wait on the message queue.
+func (m *Manager) publishLoop() {
+	for work := range m.workQueue.work {
+		if err := m.workQueue.PublishWork(m.workHash(work.header), work); err != nil {
+			log.Println("Failed to publish work to queue", "err", err)
+		}
+	}
+}
+
+// PublishSolution publishes the solution on the solution channel.
+func (q *workQueue) PublishSolution(solution *workSolution) error {
+	payload, err := json.Marshal(solution)
+	if err != nil {
+		return err
+	}
+	return q.publish(q.solutionChannel, payload)
+}
+
+// publish publishes the payload on the channel over the shared connection.
+func (q *workQueue) publish(channel string, payload []byte) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.conn == nil {
+		conn, err := net.DialTimeout("tcp", q.addr, workQueueTimeout)
+		if err != nil {
+			return err
+		}
+		q.conn, q.reader = conn, bufio.NewReader(conn)
+	}
+	q.conn.SetDeadline(time.Now().Add(workQueueTimeout))
+	err := writeRESP(q.conn, "PUBLISH", channel, string(payload))
+	if err == nil {
+		_, err = readRESP(q.reader)
+	}
+	if err != nil {
+		// drop the connection so that the next publish reconnects
+		q.conn.Close()
+		q.conn, q.reader = nil, nil
+	}
+	return err
+}
+
+// Solution returns the published work package of the solution, with its header sealed with the
+// solution nonce.
+func (q *workQueue) Solution(solution *workSolution) (*queuedWork, error) {
+	cached, ok := q.history.Get(solution.WorkHash)
+	if !ok {
+		return nil, errors.New("solution for unknown or expired work")
+	}
+	work := *cached.(*queuedWork)
+	work.header = copyHeader(work.header)
+	work.header.Nonce = solution.Nonce
+	return &work, nil
+}
+
+// subscribeSolutions listens on the solution channel and passes each valid solution to m.resultCh.
+// It reconnects with a fixed delay if the connection to the queue is lost.
+func (m *Manager) subscribeSolutions() {
+	for {
+		if err := m.readSolutions(); err != nil {
+			log.Println("Work queue subscription lost, reconnecting", "addr", m.workQueue.addr, "err", err)
+		}
+		time.Sleep(workQueueTimeout)
+	}
+}
+
+func (m *Manager) readSolutions() error {
+	return m.workQueue.subscribe(m.workQueue.solutionChannel, m.handleSolution)
+}
+
+// handleSolution passes the solution published by a hasher to m.resultCh if it is valid. It is
+// submitted with the pending blocks of its work package, not the ones mined at the moment.
+func (m *Manager) handleSolution(payload string) {
+	var solution workSolution
+	if err := json.Unmarshal([]byte(payload), &solution); err != nil {
+		log.Println("Invalid solution received from work queue", "err", err)
+		return
+	}
+	work, err := m.workQueue.Solution(&solution)
+	if err != nil {
+		log.Println("Discarding solution from work queue", "workHash", solution.WorkHash, "err", err)
+		return
+	}
+	order, err := m.engine.GetDifficultyOrder(work.header)
+	if err != nil {
+		log.Println("Discarding solution from work queue", "workHash", solution.WorkHash, "err", err)
+		return
+	}
+	m.resultCh <- &minedResult{HeaderBundle: &types.HeaderBundle{Header: work.header, Context: order}, pending: work.pending, location: work.location}
+}
+
+// subscribe subscribes to the channel on a connection of its own and passes the payload of
+// every message to handle until the connection fails.
+func (q *workQueue) subscribe(channel string, handle func(payload string)) error {
+	conn, err := net.DialTimeout("tcp", q.addr, workQueueTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := writeRESP(conn, "SUBSCRIBE", channel); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(conn)
+	for {
+		reply, err := readRESP(reader)
+		if err != nil {
+			return err
+		}
+		message, ok := reply.([]interface{})
+		if !ok || len(message) != 3 || message[0] != "message" {
+			continue
+		}
+		payload, _ := message[2].(string)
+		handle(payload)
+	}
+}
+
+// writeRESP writes a command as a RESP array of bulk strings.
+func writeRESP(w io.Writer, args ...string) error {
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(arg))+"\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// readRESP reads a single RESP reply. Arrays are returned as []interface{}, bulk and simple
+// strings as string and integers as int64.
+func readRESP(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, errors.New("malformed reply from work queue")
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, errors.New(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(body)
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		items := make([]interface{}, 0, count)
+		for i := 0; i < count; i++ {
+			item, err := readRESP(r)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unexpected reply type %q from work queue", kind)
+}